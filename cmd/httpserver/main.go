@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
@@ -9,53 +10,63 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/GhostVox/httptcp/internal/fileserver"
 	"github.com/GhostVox/httptcp/internal/headers"
+	"github.com/GhostVox/httptcp/internal/middleware"
 	"github.com/GhostVox/httptcp/internal/request"
 	"github.com/GhostVox/httptcp/internal/response"
+	"github.com/GhostVox/httptcp/internal/router"
 	"github.com/GhostVox/httptcp/internal/server"
 )
 
 const port = 42069
 
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	handler := middleware.Chain(middleware.Logging(nil))(routes().ServeRequest)
 	server, err := server.Serve(port, handler)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handler(w response.Writer, req *request.Request) {
-	if req.RequestLine.RequestTarget == "/yourproblem" {
-		handler400(w, req)
-		return
-	}
-	if req.RequestLine.RequestTarget == "/myproblem" {
-		handler500(w, req)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server forced to stop: %v", err)
 		return
 	}
+	log.Println("Server gracefully stopped")
+}
 
-	if strings.Contains(req.RequestLine.RequestTarget, "/httpbin") {
-		proxyHandler(w, req)
-		return
+func routes() *router.Router {
+	r := router.New()
+	r.Get("/", handler200)
+	r.Handle("", "/yourproblem", handler400)
+	r.Handle("", "/myproblem", handler500)
+	r.Get("/video", handlerVideo)
 
-	}
-	if req.RequestLine.RequestTarget == "/video" {
-		handlerVideo(w, req)
-		return
-	}
+	httpbin := r.Group("/httpbin")
+	httpbin.Handle("", "/{path...}", proxyHandler)
 
-	handler200(w, req)
+	assets, err := fileserver.Dir("assets", fileserver.WithStripPrefix("/assets"), fileserver.WithListings())
+	if err != nil {
+		log.Printf("Not serving /assets: %v", err)
+		return r
+	}
+	r.Handle("", "/assets/{path...}", assets.ServeRequest)
+	return r
 }
 
 func handler200(w response.Writer, _ *request.Request) {
@@ -69,9 +80,8 @@ func handler200(w response.Writer, _ *request.Request) {
     <p>Your request was an absolute banger.</p>
   </body>
 </html>` + "\n"
-	headers := response.GetDefaultHeaders(len(Message))
-	w.WriteHeaders(headers)
-	w.Writer.Write([]byte(Message))
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(Message))
 }
 
 func handler400(w response.Writer, _ *request.Request) {
@@ -85,10 +95,8 @@ func handler400(w response.Writer, _ *request.Request) {
     <p>Your request honestly kinda sucked.</p>
   </body>
 </html>` + "\n"
-	headers := response.GetDefaultHeaders(len(Message))
-	w.WriteHeaders(headers)
-	w.Writer.Write([]byte(Message))
-
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(Message))
 }
 
 func handler500(w response.Writer, _ *request.Request) {
@@ -102,24 +110,15 @@ func handler500(w response.Writer, _ *request.Request) {
     <p>Okay, you know what? This one is on me.</p>
   </body>
 </html>` + "\n"
-	headers := response.GetDefaultHeaders(len(Message))
-	w.WriteHeaders(headers)
-	w.Writer.Write([]byte(Message))
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(Message))
 }
 
-func handlerVideo(w response.Writer, _ *request.Request) {
-	w.WriteStatusLine(response.Success)
-	h := response.GetDefaultHeaders(0)
-	h.Delete("Content-Length")
-	h.Delete("Content-Type")
-	h.Set("Content-Type", "video/mp4")
-	h.Set("Transfer-Encoding", "chunked")
-	h.Set("Connection", "keep-alive")
-	h.Set("Trailer", "X-Content-SHA256, X-Content-Length")
-	w.WriteHeaders(h)
+func handlerVideo(w response.Writer, req *request.Request) {
 	directory, err := os.Getwd()
 	if err != nil {
 		log.Println("Error getting current directory: ", err)
+		handler500(w, req)
 		return
 	}
 	filePath := path.Dir(directory) + "/httpfromtcp/assets/vim.mp4"
@@ -127,44 +126,26 @@ func handlerVideo(w response.Writer, _ *request.Request) {
 	if err != nil {
 		log.Println("Error opening file: ",
 			err)
+		handler500(w, req)
 		return
 	}
 	defer file.Close()
-	buf := make([]byte, 1024)
-	hasher := sha256.New()
-	var allContent []byte
-	for {
-		n, err := file.Read(buf)
-		if n > 0 {
-
-			chunk := make([]byte, n)
-			copy(chunk, buf[:n])
-			allContent = append(allContent, chunk...)
-			_, writeErr := w.WriteChunkedBody(buf[:n])
-			if writeErr != nil {
-				log.Printf("Error writing chunk: %v", writeErr)
-				break
-			}
-		}
+	w.Header().Set("Content-Type", "video/mp4")
+	// Players seeking into the video ask for ranges; the whole video goes
+	// out with a Content-Length through sendfile.
+	if req.Headers.Has("Range") {
+		info, err := file.Stat()
 		if err != nil {
-			if err == io.EOF {
-				err := w.WriteChunkedBodyEnd()
-				if err != nil {
-					log.Printf("Error writing chunk end: %v", err)
-				}
-				break
-			}
-			log.Printf("Error reading from source: %v", err)
+			handler500(w, req)
 			return
 		}
+		fileserver.ServeContent(w, req, filePath, file, info.ModTime())
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	if err := w.ServeFile(file); err != nil {
+		log.Printf("Error sending video: %v", err)
 	}
-	totalContent := len(allContent)
-	hash := hasher.Sum(nil)
-	trailers := headers.Headers{}
-	trailers.Set("X-Content-SHA256", fmt.Sprintf("%x", hash))
-	trailers.Set("X-Content-Length", fmt.Sprintf("%d", totalContent))
-	w.WriteTrailers(trailers)
-	log.Printf("Total content: %d bytes, SHA-256: %x", totalContent, hash)
 }
 
 func proxyHandler(w response.Writer, req *request.Request) {
@@ -176,16 +157,21 @@ func proxyHandler(w response.Writer, req *request.Request) {
 	}
 	// Make request to httpbin
 	requestAddr := fmt.Sprintf("http://httpbin.org%s", target)
-	request, err := http.NewRequest(req.RequestLine.Method, requestAddr, nil)
+	// Tie the upstream call to our request so it is aborted when the client
+	// disconnects or the server shuts down.
+	request, err := http.NewRequestWithContext(req.Context(), req.RequestLine.Method, requestAddr, nil)
 	if err != nil {
 		handler500(w, req)
 		return
 	}
 
 	// Copy original request headers
-	for key, values := range req.Headers {
-		request.Header.Set(key, values)
-	}
+	req.Headers.Range(func(name string, values []string) bool {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+		return true
+	})
 
 	// Send request
 	resp, err := client.Do(request)
@@ -195,20 +181,26 @@ func proxyHandler(w response.Writer, req *request.Request) {
 	}
 	defer resp.Body.Close()
 
-	// Write the status line with the appropriate status code
-
-	w.WriteStatusLine(response.Success)
+	// Relay the upstream status as it was sent, reason phrase included.
+	reason := strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)+" ")
+	if err := w.WriteStatusLineReason(response.StatusCode(resp.StatusCode), reason); err != nil {
+		handler500(w, req)
+		return
+	}
 
 	// Set headers and transfer them to my server's response
-	h := headers.Headers{}
+	h := headers.NewHeaders()
 	resp.Header.Set("Transfer-Encoding", "chunked")
 	resp.Header.Del("Content-Length")
 	resp.Header.Set("Connection", "keep-alive")
 	for key, values := range resp.Header {
 		for _, value := range values {
-			h.Set(key, value)
+			h.Add(key, value)
 		}
 	}
+	// The upstream is not ours to trust; clean its headers rather than
+	// relay something that could split our response.
+	h.Sanitize()
 
 	// Advertise that trailers will be included
 	h.Set("Trailer", "X-Content-SHA256, X-Content-Length")
@@ -259,7 +251,7 @@ func proxyHandler(w response.Writer, req *request.Request) {
 	hash := hasher.Sum(nil)
 
 	// Add trailers
-	trailers := headers.Headers{}
+	trailers := headers.NewHeaders()
 	trailers.Set("X-Content-SHA256", fmt.Sprintf("%x", hash))
 	trailers.Set("X-Content-Length", fmt.Sprintf("%d", totalContent))
 	w.WriteTrailers(trailers)
@@ -30,12 +30,18 @@ func main() {
 		fmt.Printf("- Target: %s\n", request.RequestLine.RequestTarget)
 		fmt.Printf("- Version: %s\n", request.RequestLine.HttpVersion)
 		fmt.Println("Headers:")
-		for header, value := range request.Headers {
-			fmt.Printf("- %s: %s\n", header, value)
-
-		}
+		request.Headers.Range(func(name string, values []string) bool {
+			for _, value := range values {
+				fmt.Printf("- %s: %s\n", name, value)
+			}
+			return true
+		})
 		fmt.Println("Body:")
-		fmt.Printf("%s\n", request.Body)
+		body, err := request.ReadBody()
+		if err != nil {
+			log.Println("Failed to read body:", err)
+		}
+		fmt.Printf("%s\n", body)
 
 		fmt.Printf("Channel has been closed\n")
 	}
@@ -0,0 +1,201 @@
+// Package fileserver serves static files from a directory or any fs.FS,
+// including an embed.FS.
+//
+// Request paths are cleaned and resolved inside the file system, so they
+// cannot reach anything outside it. A directory is served through its
+// index.html, or as a generated listing when listings are enabled.
+package fileserver
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+)
+
+const indexPage = "index.html"
+
+// FileServer serves the files of an fs.FS.
+type FileServer struct {
+	fsys     fs.FS
+	prefix   string
+	listings bool
+}
+
+// Option configures a FileServer.
+type Option func(*FileServer)
+
+// WithListings turns on HTML listings for directories without an
+// index.html. Without it such directories are 403 Forbidden.
+func WithListings() Option {
+	return func(s *FileServer) {
+		s.listings = true
+	}
+}
+
+// WithStripPrefix removes prefix from request paths before they are looked
+// up, for a FileServer mounted under a path such as "/static".
+func WithStripPrefix(prefix string) Option {
+	return func(s *FileServer) {
+		s.prefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// New returns a FileServer for fsys.
+func New(fsys fs.FS, opts ...Option) *FileServer {
+	s := &FileServer{fsys: fsys}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Dir returns a FileServer for the directory root. Files are opened
+// through an os.Root, so symlinks cannot lead outside root either.
+func Dir(root string, opts ...Option) (*FileServer, error) {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	return New(r.FS(), opts...), nil
+}
+
+// ServeRequest is a server.Handler serving GET and HEAD requests.
+func (s *FileServer) ServeRequest(w response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	if method != "GET" && method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, response.MethodNotAllowed)
+		return
+	}
+
+	urlPath := req.Path()
+	name, ok := s.resolve(urlPath)
+	if !ok {
+		writeError(w, response.NotFound)
+		return
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		writeError(w, statusForError(err))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, statusForError(err))
+		return
+	}
+
+	if info.IsDir() {
+		// Relative links in the directory, and in its listing, only
+		// resolve against a path that ends in a slash.
+		if !strings.HasSuffix(urlPath, "/") {
+			w.Header().Set("Location", path.Base(urlPath)+"/")
+			writeError(w, response.MovedPermanently)
+			return
+		}
+		index, err := s.fsys.Open(path.Join(name, indexPage))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				writeError(w, statusForError(err))
+				return
+			}
+			if !s.listings {
+				writeError(w, response.Forbidden)
+				return
+			}
+			s.serveListing(w, req, name, urlPath)
+			return
+		}
+		defer index.Close()
+		f = index
+		if info, err = f.Stat(); err != nil {
+			writeError(w, statusForError(err))
+			return
+		}
+		name = path.Join(name, indexPage)
+	}
+	serveContent(w, req, name, f, info)
+}
+
+// resolve maps a URL path onto a name in the file system. The request
+// parser has already removed dot segments; cleaning again keeps handlers
+// fed from elsewhere just as safe.
+func (s *FileServer) resolve(urlPath string) (string, bool) {
+	if s.prefix != "" {
+		rest, ok := strings.CutPrefix(urlPath, s.prefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			return "", false
+		}
+		urlPath = rest
+	}
+	if strings.ContainsAny(urlPath, "\\\x00") {
+		return "", false
+	}
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
+
+// serveContent writes f as the body with its type and length. HEAD gets
+// the same headers and no body. Files that can seek, which includes those
+// of os, embed and fstest, also serve Range requests.
+func serveContent(w response.Writer, req *request.Request, name string, f fs.File, info fs.FileInfo) {
+	if content, ok := f.(io.ReadSeeker); ok {
+		ServeContent(w, req, name, content, info.ModTime())
+		return
+	}
+	body, contentType, err := detectType(name, f)
+	if err != nil {
+		writeError(w, response.InternalServerError)
+		return
+	}
+	w.WriteStatusLine(response.Success)
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if modTime := info.ModTime(); !modTime.IsZero() {
+		h.Set("Last-Modified", headers.FormatTime(modTime))
+	}
+	if req.RequestLine.Method == "HEAD" {
+		w.WriteHeaders(h)
+		return
+	}
+	io.Copy(w, body)
+}
+
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid), isPathEscape(err):
+		// A link out of the root points at nothing the server serves.
+		return response.NotFound
+	case errors.Is(err, fs.ErrPermission):
+		return response.Forbidden
+	default:
+		return response.InternalServerError
+	}
+}
+
+// isPathEscape reports whether err is os.Root refusing to follow a link
+// out of the root. The os package does not export that error, so it is
+// recognised by its text.
+func isPathEscape(err error) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr) && pathErr.Err.Error() == "path escapes from parent"
+}
+
+func writeError(w response.Writer, code response.StatusCode) {
+	w.WriteStatusLine(code)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(response.StatusText(code) + "\n"))
+}
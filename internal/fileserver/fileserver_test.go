@@ -0,0 +1,273 @@
+package fileserver
+
+import (
+	"bytes"
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+var modTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":        {Data: []byte("<p>home</p>"), ModTime: modTime},
+		"style.css":         {Data: []byte("body{}"), ModTime: modTime},
+		"notes":             {Data: []byte("plain words\n"), ModTime: modTime},
+		"blob":              {Data: []byte{0x00, 0x01, 0x02, 0xff}, ModTime: modTime},
+		"image":             {Data: []byte("\x89PNG\r\n\x1a\n...."), ModTime: modTime},
+		"docs/a.txt":        {Data: []byte("a"), ModTime: modTime},
+		"docs/sub/b.txt":    {Data: []byte("b"), ModTime: modTime},
+		"docs/<b>&x y.txt":  {Data: []byte("c"), ModTime: modTime},
+		"private/secret.md": {Data: []byte("secret"), ModTime: modTime},
+	}
+}
+
+type result struct {
+	status string
+	header map[string]string
+	body   string
+}
+
+func serve(t *testing.T, s *FileServer, method, target string, fields ...string) result {
+	t.Helper()
+	return serveFunc(t, s.ServeRequest, method, target, fields...)
+}
+
+// serveFunc runs handler for a request with the given header field lines
+// and splits up the response it writes.
+func serveFunc(t *testing.T, handler func(response.Writer, *request.Request), method, target string, fields ...string) result {
+	t.Helper()
+	raw := method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n"
+	for _, field := range fields {
+		raw += field + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewResponse(&buf)
+	handler(w, req)
+	require.NoError(t, w.Finish())
+
+	head, body, ok := strings.Cut(buf.String(), "\r\n\r\n")
+	require.True(t, ok, "no end of headers in %q", buf.String())
+	lines := strings.Split(head, "\r\n")
+	res := result{status: lines[0], header: map[string]string{}, body: body}
+	for _, line := range lines[1:] {
+		name, value, _ := strings.Cut(line, ": ")
+		res.header[strings.ToLower(name)] = value
+	}
+	return res
+}
+
+func TestFileServer_Files(t *testing.T) {
+	s := New(testFS())
+
+	tests := []struct {
+		target      string
+		contentType string
+		body        string
+	}{
+		{"/style.css", "text/css; charset=utf-8", "body{}"},
+		{"/docs/a.txt", "text/plain; charset=utf-8", "a"},
+		{"/notes", "text/plain; charset=utf-8", "plain words\n"},
+		{"/blob", "application/octet-stream", "\x00\x01\x02\xff"},
+		{"/image", "image/png", "\x89PNG\r\n\x1a\n...."},
+		{"/", "text/html; charset=utf-8", "<p>home</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			res := serve(t, s, "GET", tt.target)
+			assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+			assert.Equal(t, tt.contentType, res.header["content-type"])
+			assert.Equal(t, tt.body, res.body)
+			assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", res.header["last-modified"])
+		})
+	}
+}
+
+func TestFileServer_Head(t *testing.T) {
+	res := serve(t, New(testFS()), "HEAD", "/style.css")
+	assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+	assert.Equal(t, "6", res.header["content-length"])
+	assert.Equal(t, "", res.body)
+}
+
+func TestFileServer_Errors(t *testing.T) {
+	s := New(testFS())
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status string
+	}{
+		{"missing", "GET", "/nope.txt", "HTTP/1.1 404 Not Found"},
+		{"missing below a file", "GET", "/style.css/x", "HTTP/1.1 404 Not Found"},
+		{"traversal", "GET", "/../../etc/passwd", "HTTP/1.1 404 Not Found"},
+		{"encoded traversal", "GET", "/docs/%2e%2e/%2e%2e/etc/passwd", "HTTP/1.1 404 Not Found"},
+		{"backslash", "GET", "/docs%5c..%5cstyle.css", "HTTP/1.1 404 Not Found"},
+		{"directory without index", "GET", "/private/", "HTTP/1.1 403 Forbidden"},
+		{"method", "POST", "/style.css", "HTTP/1.1 405 Method Not Allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := serve(t, s, tt.method, tt.target)
+			assert.Equal(t, tt.status, res.status)
+		})
+	}
+
+	res := serve(t, s, "DELETE", "/")
+	assert.Equal(t, "GET, HEAD", res.header["allow"])
+}
+
+func TestFileServer_Resolve(t *testing.T) {
+	s := New(testFS(), WithStripPrefix("/static/"))
+
+	tests := []struct {
+		path string
+		name string
+		ok   bool
+	}{
+		{"/static", ".", true},
+		{"/static/", ".", true},
+		{"/static/docs/a.txt", "docs/a.txt", true},
+		{"/static/../docs/a.txt", "docs/a.txt", true},
+		{"/static/docs/../../../etc", "etc", true},
+		{"/staticfoo/a.txt", "", false},
+		{"/other/a.txt", "", false},
+		{"/static/a\\b", "", false},
+		{"/static/a\x00b", "", false},
+	}
+	for _, tt := range tests {
+		name, ok := s.resolve(tt.path)
+		assert.Equal(t, tt.ok, ok, tt.path)
+		assert.Equal(t, tt.name, name, tt.path)
+	}
+}
+
+func TestFileServer_DirectoryRedirect(t *testing.T) {
+	res := serve(t, New(testFS(), WithListings()), "GET", "/docs")
+	assert.Equal(t, "HTTP/1.1 301 Moved Permanently", res.status)
+	assert.Equal(t, "docs/", res.header["location"])
+}
+
+func TestFileServer_Listing(t *testing.T) {
+	s := New(testFS(), WithListings())
+
+	res := serve(t, s, "GET", "/docs/")
+	assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+	assert.Equal(t, "text/html; charset=utf-8", res.header["content-type"])
+	assert.Contains(t, res.body, "<title>Index of /docs/</title>")
+	assert.Contains(t, res.body, `<a href="../">../</a>`)
+	assert.Contains(t, res.body, `<a href="./a.txt">a.txt</a>`)
+	assert.Contains(t, res.body, `<a href="./sub/">sub/</a>`)
+	assert.Contains(t, res.body, `<a href="./%3Cb%3E&amp;x%20y.txt">&lt;b&gt;&amp;x y.txt</a>`)
+
+	// A directory with an index.html is still served through it.
+	res = serve(t, s, "GET", "/")
+	assert.Equal(t, "<p>home</p>", res.body)
+
+	res = serve(t, s, "HEAD", "/docs/")
+	assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+	assert.NotEmpty(t, res.header["content-length"])
+	assert.Equal(t, "", res.body)
+}
+
+func TestFileServer_StripPrefix(t *testing.T) {
+	s := New(testFS(), WithStripPrefix("/static"))
+
+	res := serve(t, s, "GET", "/static/docs/a.txt")
+	assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+	assert.Equal(t, "a", res.body)
+
+	res = serve(t, s, "GET", "/docs/a.txt")
+	assert.Equal(t, "HTTP/1.1 404 Not Found", res.status)
+}
+
+func TestFileServer_Embed(t *testing.T) {
+	sub, err := fs.Sub(testdata, "testdata")
+	require.NoError(t, err)
+	s := New(sub)
+
+	res := serve(t, s, "GET", "/")
+	assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+	assert.Contains(t, res.body, "<title>embedded</title>")
+
+	res = serve(t, s, "GET", "/docs/readme.txt")
+	assert.Equal(t, "hello from embed\n", res.body)
+	// Embedded files have no modification time to send.
+	assert.NotContains(t, res.header, "last-modified")
+
+	res = serve(t, s, "GET", "/docs/")
+	assert.Equal(t, "HTTP/1.1 403 Forbidden", res.status)
+}
+
+func TestFileServer_Dir(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "page.html"), []byte("<h1>hi</h1>"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "empty"), 0o755))
+	// A link out of the root must not be followed.
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	require.NoError(t, os.WriteFile(outside, []byte("outside"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "escape.txt")))
+
+	s, err := Dir(root, WithListings())
+	require.NoError(t, err)
+
+	res := serve(t, s, "GET", "/page.html")
+	assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+	assert.Equal(t, "text/html; charset=utf-8", res.header["content-type"])
+	assert.Equal(t, "11", res.header["content-length"])
+	assert.Equal(t, "<h1>hi</h1>", res.body)
+
+	res = serve(t, s, "GET", "/empty/")
+	assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+
+	res = serve(t, s, "GET", "/escape.txt")
+	assert.Equal(t, "HTTP/1.1 404 Not Found", res.status)
+	assert.Equal(t, "Not Found\n", res.body)
+
+	_, err = Dir(filepath.Join(root, "missing"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		head string
+		want string
+	}{
+		{"", "text/plain; charset=utf-8"},
+		{"  <!DOCTYPE HTML><html>", "text/html; charset=utf-8"},
+		{"<html><body>", "text/html; charset=utf-8"},
+		{"<?xml version=\"1.0\"?>", "text/xml; charset=utf-8"},
+		{"%PDF-1.7", "application/pdf"},
+		{"GIF89a....", "image/gif"},
+		{"\xff\xd8\xff\xe0", "image/jpeg"},
+		{"RIFF\x00\x00\x00\x00WEBPVP8 ", "image/webp"},
+		{"RIFF\x00\x00\x00\x00WAVEfmt ", "application/octet-stream"},
+		{"\x00\x00\x00\x18ftypmp42", "video/mp4"},
+		{"PK\x03\x04", "application/zip"},
+		{"\x1f\x8b\x08\x00", "application/gzip"},
+		{"héllo wörld", "text/plain; charset=utf-8"},
+		{"cut off \xc3", "text/plain; charset=utf-8"},
+		{"bad \xff\xfe utf-8", "application/octet-stream"},
+		{"bell\x07", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sniff([]byte(tt.head)), "%q", tt.head)
+	}
+}
@@ -0,0 +1,53 @@
+package fileserver
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+)
+
+// serveListing writes an HTML page linking to every entry of the directory
+// name, directories first marked with a trailing slash.
+func (s *FileServer) serveListing(w response.Writer, req *request.Request, name, urlPath string) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		writeError(w, statusForError(err))
+		return
+	}
+
+	var b strings.Builder
+	title := html.EscapeString("Index of " + urlPath)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<ul>\n", title, title)
+	if urlPath != "/" {
+		b.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		display := entry.Name()
+		if entry.IsDir() {
+			display += "/"
+		}
+		// The "./" keeps a name like "a:b" from being read as a scheme.
+		href := "./" + url.PathEscape(entry.Name())
+		if entry.IsDir() {
+			href += "/"
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(display))
+	}
+	b.WriteString("</ul>\n</body>\n</html>\n")
+
+	w.WriteStatusLine(response.Success)
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(b.Len()))
+	if req.RequestLine.Method == "HEAD" {
+		w.WriteHeaders(h)
+		return
+	}
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,103 @@
+package fileserver
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"path"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of a file is looked at when its extension does not
+// give away its type.
+const sniffLen = 512
+
+// signatures are the magic numbers of common formats, checked in order.
+var signatures = []struct {
+	offset      int
+	magic       []byte
+	contentType string
+}{
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte("\xff\xd8\xff"), "image/jpeg"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{8, []byte("WEBP"), "image/webp"},
+	{0, []byte("\x00\x00\x01\x00"), "image/x-icon"},
+	{4, []byte("ftyp"), "video/mp4"},
+	{0, []byte("\x1a\x45\xdf\xa3"), "video/webm"},
+	{0, []byte("OggS"), "application/ogg"},
+	{0, []byte("ID3"), "audio/mpeg"},
+	{0, []byte("PK\x03\x04"), "application/zip"},
+	{0, []byte("\x1f\x8b\x08"), "application/gzip"},
+	{0, []byte("wOFF"), "font/woff"},
+	{0, []byte("wOF2"), "font/woff2"},
+}
+
+// detectType works out the Content-Type of the file name, first from its
+// extension, then from its first bytes. It returns a reader for the whole
+// file: f itself, rewound, when it can seek, so an *os.File can still be
+// sent with sendfile.
+func detectType(name string, f io.Reader) (io.Reader, string, error) {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return f, contentType, nil
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, "", err
+	}
+	head = head[:n]
+	contentType := sniff(head)
+	if seeker, ok := f.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, "", err
+		}
+		return f, contentType, nil
+	}
+	return io.MultiReader(bytes.NewReader(head), f), contentType, nil
+}
+
+// sniff guesses the type of content from its first bytes. Anything that
+// is not a known binary format and reads as UTF-8 text is treated as text;
+// the rest is opaque.
+func sniff(head []byte) string {
+	for _, sig := range signatures {
+		if len(head) >= sig.offset+len(sig.magic) && bytes.Equal(head[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			if sig.contentType == "image/webp" && !bytes.HasPrefix(head, []byte("RIFF")) {
+				continue
+			}
+			return sig.contentType
+		}
+	}
+	text := bytes.TrimLeft(head, "\t\n\x0c\r ")
+	lower := bytes.ToLower(text[:min(len(text), 14)])
+	if bytes.HasPrefix(lower, []byte("<!doctype html")) || bytes.HasPrefix(lower, []byte("<html")) {
+		return "text/html; charset=utf-8"
+	}
+	if bytes.HasPrefix(text, []byte("<?xml")) {
+		return "text/xml; charset=utf-8"
+	}
+	if isText(head) {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+// isText reports whether head is UTF-8 without control characters other
+// than whitespace. A rune cut off at the end of head does not count
+// against it.
+func isText(head []byte) bool {
+	for len(head) > 0 {
+		r, size := utf8.DecodeRune(head)
+		if r == utf8.RuneError && size <= 1 {
+			return !utf8.FullRune(head)
+		}
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' && r != '\x0c' {
+			return false
+		}
+		head = head[size:]
+	}
+	return true
+}
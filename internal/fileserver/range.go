@@ -0,0 +1,233 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+)
+
+var (
+	// errInvalidRange means the Range header is malformed, and is ignored.
+	errInvalidRange = errors.New("invalid range")
+	// errNoOverlap means no range overlaps the content: 416.
+	errNoOverlap = errors.New("no range overlaps the content")
+)
+
+// byteRange is a satisfiable range of the content.
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// ServeContent writes content as the response to req, answering Range
+// requests with 206 Partial Content: one range as it is, several as a
+// multipart/byteranges body. A Content-Type already set through w.Header
+// is kept; otherwise it comes from name and the content itself.
+//
+// modTime, if not zero, is sent as Last-Modified and is what an If-Range
+// date is checked against. An If-Range entity tag is checked against the
+// ETag set through w.Header. When If-Range does not match, the whole
+// content is sent.
+func ServeContent(w response.Writer, req *request.Request, name string, content io.ReadSeeker, modTime time.Time) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		writeError(w, response.InternalServerError)
+		return
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		writeError(w, response.InternalServerError)
+		return
+	}
+
+	h := w.Header()
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		if _, contentType, err = detectType(name, content); err != nil {
+			writeError(w, response.InternalServerError)
+			return
+		}
+	}
+	h.Set("Accept-Ranges", "bytes")
+	if !modTime.IsZero() {
+		h.Set("Last-Modified", headers.FormatTime(modTime))
+	}
+
+	var ranges []byteRange
+	// Range only means something for GET (RFC 9110 section 14.2).
+	if rangeHeader := req.Headers.Get("Range"); rangeHeader != "" && req.RequestLine.Method == "GET" && ifRangeMatches(req, h, modTime) {
+		ranges, err = parseRange(rangeHeader, size)
+		switch {
+		case errors.Is(err, errNoOverlap):
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			writeError(w, response.RangeNotSatisfiable)
+			return
+		case err != nil:
+			ranges = nil
+		}
+		// Ranges that add up to more than the content, by overlapping
+		// or repeating, are answered with the content instead.
+		var total int64
+		for _, r := range ranges {
+			total += r.length
+		}
+		if total > size {
+			ranges = nil
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteStatusLine(response.Success)
+		if req.RequestLine.Method == "HEAD" {
+			w.WriteHeaders(h)
+			return
+		}
+		io.Copy(w, content)
+	case 1:
+		r := ranges[0]
+		if _, err := content.Seek(r.start, io.SeekStart); err != nil {
+			writeError(w, response.InternalServerError)
+			return
+		}
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Length", strconv.FormatInt(r.length, 10))
+		h.Set("Content-Range", r.contentRange(size))
+		w.WriteStatusLine(response.PartialContent)
+		io.Copy(w, io.LimitReader(content, r.length))
+	default:
+		serveMultipart(w, content, contentType, size, ranges)
+	}
+}
+
+// serveMultipart sends ranges as the parts of a multipart/byteranges body
+// (RFC 9110 section 14.6). The parts are laid out up front so the body
+// can go out with a Content-Length.
+func serveMultipart(w response.Writer, content io.ReadSeeker, contentType string, size int64, ranges []byteRange) {
+	boundary := rand.Text()
+	parts := make([]string, len(ranges))
+	length := int64(len("\r\n--" + boundary + "--\r\n"))
+	for i, r := range ranges {
+		parts[i] = fmt.Sprintf("\r\n--%s\r\nContent-Type: %s\r\nContent-Range: %s\r\n\r\n", boundary, contentType, r.contentRange(size))
+		length += int64(len(parts[i])) + r.length
+	}
+	// The first delimiter needs no CRLF before it.
+	parts[0] = parts[0][2:]
+	length -= 2
+
+	h := w.Header()
+	h.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteStatusLine(response.PartialContent)
+	for i, r := range ranges {
+		if _, err := content.Seek(r.start, io.SeekStart); err != nil {
+			return
+		}
+		if _, err := io.WriteString(w, parts[i]); err != nil {
+			return
+		}
+		if _, err := io.Copy(w, io.LimitReader(content, r.length)); err != nil {
+			return
+		}
+	}
+	io.WriteString(w, "\r\n--"+boundary+"--\r\n")
+}
+
+// parseRange parses a Range header against content of the given size,
+// dropping ranges that start past its end (RFC 9110 section 14.1.2).
+func parseRange(s string, size int64) ([]byteRange, error) {
+	unit, set, ok := strings.Cut(s, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, errInvalidRange
+	}
+	var ranges []byteRange
+	for spec := range strings.SplitSeq(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+		if first == "" {
+			// A suffix range: the last n bytes.
+			n, err := parsePos(last)
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			ranges = append(ranges, byteRange{start: size - n, length: n})
+			continue
+		}
+		start, err := parsePos(first)
+		if err != nil {
+			return nil, err
+		}
+		end := size - 1
+		if last != "" {
+			if end, err = parsePos(last); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, errInvalidRange
+			}
+			end = min(end, size-1)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, byteRange{start: start, length: end - start + 1})
+	}
+	if len(ranges) == 0 {
+		if strings.Trim(set, ", \t") == "" {
+			return nil, errInvalidRange
+		}
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+// parsePos parses the digits of a range position.
+func parsePos(s string) (int64, error) {
+	n, err := headers.ParseInt(s)
+	if err != nil {
+		return 0, errInvalidRange
+	}
+	return n, nil
+}
+
+// ifRangeMatches reports whether the Range header of req applies. Without
+// If-Range it always does; with one, only if the representation still has
+// the entity tag or modification date it names (RFC 9110 section 13.1.5).
+func ifRangeMatches(req *request.Request, h headers.Headers, modTime time.Time) bool {
+	ifRange := req.Headers.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		// Only a strong entity tag can validate a range.
+		etag := h.Get("ETag")
+		return !strings.HasPrefix(ifRange, "W/") && etag != "" && etag == ifRange
+	}
+	date, err := headers.ParseTime(ifRange)
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+	return modTime.Truncate(time.Second).Equal(date)
+}
@@ -0,0 +1,204 @@
+package fileserver
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		want   []byteRange
+		err    error
+	}{
+		{"bytes=0-4", 10, []byteRange{{0, 5}}, nil},
+		{"bytes=5-", 10, []byteRange{{5, 5}}, nil},
+		{"bytes=-3", 10, []byteRange{{7, 3}}, nil},
+		{"bytes=-30", 10, []byteRange{{0, 10}}, nil},
+		{"bytes=8-20", 10, []byteRange{{8, 2}}, nil},
+		{"Bytes = 0-0, 2-3 ,-1", 10, []byteRange{{0, 1}, {2, 2}, {9, 1}}, nil},
+		{"bytes=20-30, 1-1", 10, []byteRange{{1, 1}}, nil},
+		{"bytes=10-", 10, nil, errNoOverlap},
+		{"bytes=-0", 10, nil, errNoOverlap},
+		{"bytes=0-", 0, nil, errNoOverlap},
+		{"bytes=5-4", 10, nil, errInvalidRange},
+		{"bytes=", 10, nil, errInvalidRange},
+		{"bytes=abc", 10, nil, errInvalidRange},
+		{"bytes=1-2-3", 10, nil, errInvalidRange},
+		{"bytes=+1-2", 10, nil, errInvalidRange},
+		{"bytes=0-99999999999999999999", 10, nil, errInvalidRange},
+		{"items=0-4", 10, nil, errInvalidRange},
+		{"0-4", 10, nil, errInvalidRange},
+	}
+	for _, tt := range tests {
+		got, err := parseRange(tt.header, tt.size)
+		assert.ErrorIs(t, err, tt.err, tt.header)
+		assert.Equal(t, tt.want, got, tt.header)
+	}
+}
+
+const rangeContent = "0123456789abcdefghij"
+
+var rangeModTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func serveString(etag string) func(response.Writer, *request.Request) {
+	return func(w response.Writer, req *request.Request) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		ServeContent(w, req, "data.txt", strings.NewReader(rangeContent), rangeModTime)
+	}
+}
+
+func TestServeContent_SingleRange(t *testing.T) {
+	res := serveFunc(t, serveString(""), "GET", "/", "Range: bytes=5-9")
+	assert.Equal(t, "HTTP/1.1 206 Partial Content", res.status)
+	assert.Equal(t, "bytes 5-9/20", res.header["content-range"])
+	assert.Equal(t, "5", res.header["content-length"])
+	assert.Equal(t, "text/plain; charset=utf-8", res.header["content-type"])
+	assert.Equal(t, "56789", res.body)
+
+	res = serveFunc(t, serveString(""), "GET", "/", "Range: bytes=-4")
+	assert.Equal(t, "bytes 16-19/20", res.header["content-range"])
+	assert.Equal(t, "ghij", res.body)
+}
+
+func TestServeContent_WholeContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		fields []string
+	}{
+		{"no range", "GET", nil},
+		{"malformed range", "GET", []string{"Range: bytes=9-2"}},
+		{"unknown unit", "GET", []string{"Range: lines=1-2"}},
+		{"overlapping ranges", "GET", []string{"Range: bytes=0-15,5-19"}},
+		{"range on HEAD", "HEAD", []string{"Range: bytes=0-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := serveFunc(t, serveString(""), tt.method, "/", tt.fields...)
+			assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+			assert.Equal(t, "bytes", res.header["accept-ranges"])
+			assert.Equal(t, "20", res.header["content-length"])
+			assert.NotContains(t, res.header, "content-range")
+			if tt.method == "GET" {
+				assert.Equal(t, rangeContent, res.body)
+			} else {
+				assert.Equal(t, "", res.body)
+			}
+		})
+	}
+}
+
+func TestServeContent_NotSatisfiable(t *testing.T) {
+	res := serveFunc(t, serveString(""), "GET", "/", "Range: bytes=20-30")
+	assert.Equal(t, "HTTP/1.1 416 Range Not Satisfiable", res.status)
+	assert.Equal(t, "bytes */20", res.header["content-range"])
+}
+
+func TestServeContent_MultipleRanges(t *testing.T) {
+	res := serveFunc(t, serveString(""), "GET", "/", "Range: bytes=0-2, 10-12,-2")
+	assert.Equal(t, "HTTP/1.1 206 Partial Content", res.status)
+	assert.NotContains(t, res.header, "content-range")
+	assert.Equal(t, strconv.Itoa(len(res.body)), res.header["content-length"])
+
+	mediaType, params, err := mime.ParseMediaType(res.header["content-type"])
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	mr := multipart.NewReader(strings.NewReader(res.body), params["boundary"])
+	want := []struct{ contentRange, body string }{
+		{"bytes 0-2/20", "012"},
+		{"bytes 10-12/20", "abc"},
+		{"bytes 18-19/20", "ij"},
+	}
+	for _, w := range want {
+		part, err := mr.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, "text/plain; charset=utf-8", part.Header.Get("Content-Type"))
+		assert.Equal(t, w.contentRange, part.Header.Get("Content-Range"))
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, w.body, string(body))
+	}
+	_, err = mr.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServeContent_IfRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		etag    string
+		ifRange string
+		partial bool
+	}{
+		{"same date", "", "Fri, 01 Mar 2024 12:00:00 GMT", true},
+		{"older date", "", "Thu, 29 Feb 2024 12:00:00 GMT", false},
+		{"bad date", "", "yesterday", false},
+		{"same tag", `"v1"`, `"v1"`, true},
+		{"other tag", `"v1"`, `"v2"`, false},
+		{"weak tag", `W/"v1"`, `W/"v1"`, false},
+		{"tag without ETag", "", `"v1"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := serveFunc(t, serveString(tt.etag), "GET", "/", "Range: bytes=0-0", "If-Range: "+tt.ifRange)
+			if tt.partial {
+				assert.Equal(t, "HTTP/1.1 206 Partial Content", res.status)
+				assert.Equal(t, "0", res.body)
+			} else {
+				assert.Equal(t, "HTTP/1.1 200 OK", res.status)
+				assert.Equal(t, rangeContent, res.body)
+			}
+		})
+	}
+}
+
+func TestServeContent_KeepsContentType(t *testing.T) {
+	handler := func(w response.Writer, req *request.Request) {
+		w.Header().Set("Content-Type", "application/x-custom")
+		ServeContent(w, req, "data.txt", strings.NewReader(rangeContent), time.Time{})
+	}
+	res := serveFunc(t, handler, "GET", "/", "Range: bytes=1-1")
+	assert.Equal(t, "application/x-custom", res.header["content-type"])
+	assert.NotContains(t, res.header, "last-modified")
+	assert.Equal(t, "1", res.body)
+}
+
+func TestFileServer_Range(t *testing.T) {
+	// Test: Files from an fs.FS serve ranges
+	res := serve(t, New(testFS()), "GET", "/notes", "Range: bytes=6-10")
+	assert.Equal(t, "HTTP/1.1 206 Partial Content", res.status)
+	assert.Equal(t, "bytes 6-10/12", res.header["content-range"])
+	assert.Equal(t, "words", res.body)
+
+	// Test: So do files on disk, which go out from an *os.File
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "video.mp4"), []byte(rangeContent), 0o644))
+	s, err := Dir(root)
+	require.NoError(t, err)
+	res = serve(t, s, "GET", "/video.mp4", "Range: bytes=10-")
+	assert.Equal(t, "HTTP/1.1 206 Partial Content", res.status)
+	assert.Equal(t, "video/mp4", res.header["content-type"])
+	assert.Equal(t, "bytes 10-19/20", res.header["content-range"])
+	assert.Equal(t, "abcdefghij", res.body)
+
+	res = serve(t, s, "GET", "/video.mp4", "Range: bytes=0-1,18-")
+	assert.Equal(t, "HTTP/1.1 206 Partial Content", res.status)
+	assert.Contains(t, res.body, "\r\n\r\n01\r\n")
+	assert.Contains(t, res.body, "\r\n\r\nij\r\n")
+}
@@ -4,10 +4,28 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync/atomic"
 )
 
-type Headers map[string]string
+// Headers maps field names to their values. Lookups ignore case, the name
+// is written out with the casing it was first added with, and repeated
+// fields keep every value in order instead of being comma-joined, which
+// matters for fields like Set-Cookie that cannot be combined.
+type Headers map[string]*field
+
+type field struct {
+	name   string
+	values []string
+	// order records when the field was first added so Range can follow
+	// insertion order.
+	order uint64
+}
+
+// fieldOrder only ever increases, so comparing two fields' order tells
+// which was added first, whichever Headers they live in.
+var fieldOrder atomic.Uint64
 
 const (
 	clrf = "\r\n"
@@ -16,31 +34,110 @@ const (
 func NewHeaders() Headers {
 	return make(Headers)
 }
-func (h Headers) Set(key, value string) {
-	if v, ok := h[key]; ok {
-		h[key] = v + ", " + value
-		return
-	}
-	h[key] = value
+
+func canonicalKey(key string) string {
+	return strings.ToLower(key)
 }
 
+// Get returns all values for key joined with ", ", which is how repeated
+// fields combine per RFC 9110 section 5.3. Use Values for fields that must
+// not be combined.
 func (h Headers) Get(key string) string {
-	key = strings.ToLower(key)
-	if _, ok := h[key]; !ok {
+	f, ok := h[canonicalKey(key)]
+	if !ok {
 		return ""
 	}
-	return h[key]
+	return strings.Join(f.values, ", ")
+}
+
+// Values returns every value for key in the order they were added.
+func (h Headers) Values(key string) []string {
+	f, ok := h[canonicalKey(key)]
+	if !ok {
+		return nil
+	}
+	return f.values
+}
+
+func (h Headers) Has(key string) bool {
+	_, ok := h[canonicalKey(key)]
+	return ok
 }
-func (h Headers) OverrideHeader(key, value string) {
-	if _, ok := h[key]; ok {
-		h[key] = value
+
+// Set replaces any values for key with value.
+func (h Headers) Set(key, value string) {
+	canonical := canonicalKey(key)
+	if f, ok := h[canonical]; ok {
+		f.values = []string{value}
 		return
 	}
-	h[key] = value
+	h[canonical] = &field{name: key, values: []string{value}, order: fieldOrder.Add(1)}
 }
-func (h Headers) Delete(key string) {
-	delete(h, key)
+
+// Add appends value to the values for key.
+func (h Headers) Add(key, value string) {
+	canonical := canonicalKey(key)
+	if f, ok := h[canonical]; ok {
+		f.values = append(f.values, value)
+		return
+	}
+	h[canonical] = &field{name: key, values: []string{value}, order: fieldOrder.Add(1)}
+}
+
+func (h Headers) Del(key string) {
+	delete(h, canonicalKey(key))
+}
+
+// Clone returns a deep copy of h that keeps its ordering.
+func (h Headers) Clone() Headers {
+	if h == nil {
+		return nil
+	}
+	clone := make(Headers, len(h))
+	for k, f := range h {
+		clone[k] = &field{
+			name:   f.name,
+			values: append([]string(nil), f.values...),
+			order:  f.order,
+		}
+	}
+	return clone
 }
+
+// Range calls fn for each field in the order the fields were first added,
+// with the name in its original casing. It stops early if fn returns false.
+func (h Headers) Range(fn func(name string, values []string) bool) {
+	fields := make([]*field, 0, len(h))
+	for _, f := range h {
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].order < fields[j].order
+	})
+	for _, f := range fields {
+		if !fn(f.name, f.values) {
+			return
+		}
+	}
+}
+
+// RangeSorted is like Range but visits fields sorted by their
+// case-insensitive name, so the output does not depend on how the fields
+// were built up.
+func (h Headers) RangeSorted(fn func(name string, values []string) bool) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f := h[k]
+		if !fn(f.name, f.values) {
+			return
+		}
+	}
+}
+
 func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	idx := bytes.Index(data, []byte(clrf))
 	// check if the registered nurse is not found
@@ -56,18 +153,21 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 
 	// split the header into key and value
 	parts := bytes.SplitN(header, []byte(":"), 2)
+	if len(parts) != 2 {
+		return 0, false, errors.New("Missing colon in header")
+	}
 	// check if the header key is valid
 	if bytes.HasSuffix(parts[0], []byte(" ")) {
 		return 0, false, errors.New("Invalid spacing")
 	}
 
-	stripedKey := bytes.ToLower(bytes.TrimSpace(parts[0]))
+	stripedKey := bytes.TrimSpace(parts[0])
 	if !checkHeaderKey(stripedKey) {
 		return 0, false, errors.New("Invalid header key")
 	}
 	key := string(stripedKey)
 	value := string(bytes.TrimSpace(parts[1]))
-	h.Set(key, value)
+	h.Add(key, value)
 
 	return idx + len(clrf), false, nil
 }
@@ -94,13 +194,85 @@ func checkHeaderKey(key []byte) bool {
 		return false
 	}
 	for _, b := range key {
-		if (b < 'a' || b > 'z') && (b < '0' || b > '9') {
+		if (b < 'a' || b > 'z') && (b < 'A' || b > 'Z') && (b < '0' || b > '9') {
 
 			if _, ok := specialCh[b]; !ok {
-				fmt.Printf("b: %c\n", b)
 				return false
 			}
 		}
 	}
 	return true
 }
+
+var (
+	ErrInvalidFieldName  = errors.New("invalid field name")
+	ErrInvalidFieldValue = errors.New("invalid field value")
+)
+
+// FieldError reports a field that cannot be written as is. Writing it would
+// let whoever controls the value add fields of their own or split the
+// message in two.
+type FieldError struct {
+	Name string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%v: %q", e.Err, e.Name)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidName reports whether name is a token, the only thing RFC 9110
+// allows as a field name.
+func ValidName(name string) bool {
+	return checkHeaderKey([]byte(name))
+}
+
+// ValidValue reports whether value can be written without ending the field
+// early: CR and LF would start a new line, NUL is rejected by most parsers.
+func ValidValue(value string) bool {
+	return !strings.ContainsAny(value, "\r\n\x00")
+}
+
+// Validate checks every field name and value, returning a *FieldError for
+// the first bad one in insertion order.
+func (h Headers) Validate() error {
+	var err error
+	h.Range(func(name string, values []string) bool {
+		if !ValidName(name) {
+			err = &FieldError{Name: name, Err: ErrInvalidFieldName}
+			return false
+		}
+		for _, value := range values {
+			if !ValidValue(value) {
+				err = &FieldError{Name: name, Err: ErrInvalidFieldValue}
+				return false
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// Sanitize makes h safe to write instead of rejecting it: fields with an
+// invalid name are dropped and CR, LF and NUL in values become spaces. It is
+// meant for headers relayed from elsewhere, such as an upstream response,
+// where failing the whole message over one bad field would be worse.
+func (h Headers) Sanitize() {
+	for k, f := range h {
+		if !ValidName(f.name) {
+			delete(h, k)
+			continue
+		}
+		for i, value := range f.values {
+			if !ValidValue(value) {
+				f.values[i] = valueReplacer.Replace(value)
+			}
+		}
+	}
+}
+
+var valueReplacer = strings.NewReplacer("\r", " ", "\n", " ", "\x00", " ")
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
@@ -15,7 +16,7 @@ func TestHeaders_Parse(t *testing.T) {
 	fmt.Printf(" expect n: 23 n: %d, expect done: false done: %t, expect err: false err: %v\n", n, done, err)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -24,7 +25,7 @@ func TestHeaders_Parse(t *testing.T) {
 	data = []byte("      Host: localhost:42069        \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 37, n)
 	assert.False(t, done)
 
@@ -33,13 +34,13 @@ func TestHeaders_Parse(t *testing.T) {
 	data = []byte("Host: localhost:42069\r\nUser-Agent: curl/7.64.1\r\ntoken: dog\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	data = data[n:]
 	x, done, err := headers.Parse(data)
-	assert.Equal(t, "curl/7.64.1", headers["user-agent"])
+	assert.Equal(t, "curl/7.64.1", headers.Get("user-agent"))
 	data = data[x:]
 	y, done, err := headers.Parse(data)
-	assert.Equal(t, "dog", headers["token"])
+	assert.Equal(t, "dog", headers.Get("token"))
 	data = data[y:]
 	z, done, err := headers.Parse(data)
 	require.NoError(t, err)
@@ -55,35 +56,36 @@ func TestHeaders_Parse(t *testing.T) {
 	assert.True(t, done)
 
 	// Test: Valid 2 headers with existing headers
-	headers = map[string]string{"host": "localhost:42069"}
+	headers = NewHeaders()
+	headers.Set("host", "localhost:42069")
 	data = []byte("User-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, "curl/7.81.0", headers["user-agent"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", headers.Get("user-agent"))
 	assert.Equal(t, 25, n)
 	assert.False(t, done)
-	assert.False(t, headers["accept"] == "*/*")
+	assert.False(t, headers.Get("accept") == "*/*")
 
 	// Test: Valid Special characters
 	headers = NewHeaders()
 	data = []byte("!#$%&'*+-.^_`|~: special characters\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "special characters", headers["!#$%&'*+-.^_`|~"])
+	assert.Equal(t, "special characters", headers.Get("!#$%&'*+-.^_`|~"))
 
 	// Test: Valid multiple value header
 	headers = NewHeaders()
 	data = []byte("Set-Person: lane-loves-go\r\nSet-Person: prime-loves-zig\r\nSet-person: tj-loves-ocaml\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "lane-loves-go", headers["set-person"])
+	assert.Equal(t, "lane-loves-go", headers.Get("set-person"))
 	x, done, err = headers.Parse(data[n:])
-	assert.Equal(t, "lane-loves-go, prime-loves-zig", headers["set-person"])
+	assert.Equal(t, "lane-loves-go, prime-loves-zig", headers.Get("set-person"))
 	y, done, err = headers.Parse(data[n+x:])
 	require.NoError(t, err)
-	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", headers["set-person"])
+	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", headers.Get("set-person"))
 
 	// Test: Invalid spacing header
 	headers = NewHeaders()
@@ -100,3 +102,128 @@ func TestHeaders_Parse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.Error(t, err)
 }
+
+func TestHeaders_MultiValue(t *testing.T) {
+	h := NewHeaders()
+	h.Add("Set-Cookie", "a=1")
+	h.Add("set-cookie", "b=2")
+	h.Set("Content-Type", "text/plain")
+
+	// Test: Lookups ignore case
+	assert.Equal(t, "text/plain", h.Get("content-type"))
+	assert.Equal(t, "text/plain", h.Get("CONTENT-TYPE"))
+	assert.True(t, h.Has("content-TYPE"))
+	assert.False(t, h.Has("Content-Length"))
+
+	// Test: Repeated fields keep every value
+	assert.Equal(t, []string{"a=1", "b=2"}, h.Values("SET-COOKIE"))
+	assert.Equal(t, "a=1, b=2", h.Get("Set-Cookie"))
+	assert.Nil(t, h.Values("missing"))
+
+	// Test: Set replaces, Del removes
+	h.Set("set-cookie", "c=3")
+	assert.Equal(t, []string{"c=3"}, h.Values("Set-Cookie"))
+	h.Del("SET-cookie")
+	assert.False(t, h.Has("Set-Cookie"))
+
+	// Test: Range keeps insertion order and the original casing
+	h = NewHeaders()
+	h.Set("X-First", "1")
+	h.Add("x-second", "2")
+	h.Add("X-SECOND", "3")
+	h.Set("X-Third", "4")
+	var names []string
+	var values [][]string
+	h.Range(func(name string, v []string) bool {
+		names = append(names, name)
+		values = append(values, v)
+		return true
+	})
+	assert.Equal(t, []string{"X-First", "x-second", "X-Third"}, names)
+	assert.Equal(t, [][]string{{"1"}, {"2", "3"}, {"4"}}, values)
+
+	// Test: Range stops when asked to
+	count := 0
+	h.Range(func(string, []string) bool {
+		count++
+		return false
+	})
+	assert.Equal(t, 1, count)
+
+	// Test: Clone is independent
+	clone := h.Clone()
+	clone.Add("X-First", "changed")
+	clone.Set("X-Fourth", "5")
+	assert.Equal(t, []string{"1"}, h.Values("X-First"))
+	assert.False(t, h.Has("X-Fourth"))
+	assert.Equal(t, []string{"1", "changed"}, clone.Values("X-First"))
+
+	// Test: Parsed headers keep their casing
+	h = NewHeaders()
+	_, _, err := h.Parse([]byte("Content-Type: text/html\r\n"))
+	require.NoError(t, err)
+	h.Range(func(name string, _ []string) bool {
+		assert.Equal(t, "Content-Type", name)
+		return true
+	})
+}
+
+func TestHeaders_RangeSorted(t *testing.T) {
+	h := NewHeaders()
+	h.Set("X-Zeta", "1")
+	h.Set("content-type", "text/plain")
+	h.Add("Accept", "a")
+	h.Add("accept", "b")
+
+	var lines []string
+	h.RangeSorted(func(name string, values []string) bool {
+		lines = append(lines, name+": "+strings.Join(values, "|"))
+		return true
+	})
+	assert.Equal(t, []string{"Accept: a|b", "content-type: text/plain", "X-Zeta: 1"}, lines)
+}
+
+func TestHeaders_Validate(t *testing.T) {
+	// Test: Valid fields
+	h := NewHeaders()
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("X-Tab", "a\tb")
+	require.NoError(t, h.Validate())
+
+	// Test: CRLF in a value
+	h.Set("X-Echo", "hi\r\nSet-Cookie: stolen=1")
+	err := h.Validate()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidFieldValue)
+	var fieldErr *FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "X-Echo", fieldErr.Name)
+
+	// Test: Bare LF and NUL in a value
+	for _, value := range []string{"a\nb", "a\rb", "a\x00b"} {
+		h := NewHeaders()
+		h.Set("X-Value", value)
+		assert.ErrorIs(t, h.Validate(), ErrInvalidFieldValue, "%q", value)
+	}
+
+	// Test: Invalid names
+	for _, name := range []string{"", "Bad Name", "X-A:b", "X-\r\nB", "Ünicode"} {
+		h := NewHeaders()
+		h.Set(name, "v")
+		assert.ErrorIs(t, h.Validate(), ErrInvalidFieldName, "%q", name)
+	}
+}
+
+func TestHeaders_Sanitize(t *testing.T) {
+	h := NewHeaders()
+	h.Set("X-Good", "fine")
+	h.Add("X-Echo", "ok")
+	h.Add("X-Echo", "hi\r\nSet-Cookie: stolen=1\x00")
+	h.Set("Bad Name", "v")
+
+	h.Sanitize()
+	require.NoError(t, h.Validate())
+	assert.Equal(t, "fine", h.Get("X-Good"))
+	assert.Equal(t, []string{"ok", "hi  Set-Cookie: stolen=1 "}, h.Values("X-Echo"))
+	assert.False(t, h.Has("Bad Name"))
+}
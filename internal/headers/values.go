@@ -0,0 +1,271 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingField = errors.New("field not present")
+	ErrInvalidValue = errors.New("invalid field value")
+	// ErrConflictingValues is an ErrInvalidValue for a repeated field
+	// whose values disagree.
+	ErrConflictingValues = fmt.Errorf("%w: conflicting values", ErrInvalidValue)
+)
+
+// TimeFormat is the IMF-fixdate format every HTTP date must be sent in.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// Recipients still have to accept the two obsolete formats (RFC 9110
+// section 5.6.7).
+var dateFormats = []string{
+	TimeFormat,
+	"Monday, 02-Jan-06 15:04:05 GMT", // RFC 850
+	"Mon Jan _2 15:04:05 2006",       // asctime
+}
+
+// Int returns key as a non-negative integer. A repeated field, as separate
+// lines or comma-separated, is only accepted if every value is the same.
+// Unlike a list, it may not have empty elements: Int decides message
+// framing, where anything loose is a way to smuggle requests.
+func (h Headers) Int(key string) (int64, error) {
+	values := h.Values(key)
+	if len(values) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrMissingField, key)
+	}
+	var n int64 = -1
+	for _, value := range values {
+		for element := range strings.SplitSeq(value, ",") {
+			v, err := ParseInt(strings.TrimSpace(element))
+			if err != nil {
+				return 0, err
+			}
+			if n != -1 && v != n {
+				return 0, fmt.Errorf("%w for %s", ErrConflictingValues, key)
+			}
+			n = v
+		}
+	}
+	return n, nil
+}
+
+// ParseInt parses a run of decimal digits. Signs, spaces and anything
+// else strconv would tolerate are rejected.
+func ParseInt(s string) (int64, error) {
+	if s == "" || len(s) > 18 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidValue, s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidValue, s)
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Time returns key parsed as an HTTP-date.
+func (h Headers) Time(key string) (time.Time, error) {
+	if !h.Has(key) {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrMissingField, key)
+	}
+	return ParseTime(h.Get(key))
+}
+
+// ParseTime parses an HTTP-date in any of the three formats HTTP has used.
+// The result is in UTC.
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range dateFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %q is not an HTTP-date", ErrInvalidValue, s)
+}
+
+// FormatTime formats t as an IMF-fixdate.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// List returns the elements of a comma-separated list field, across all of
+// its values. Empty elements are dropped.
+func (h Headers) List(key string) []string {
+	var list []string
+	for _, value := range h.Values(key) {
+		list = append(list, ParseList(value)...)
+	}
+	return list
+}
+
+// HasToken reports whether the list field key has token as one of its
+// elements, compared case-insensitively as connection options and
+// transfer codings are.
+func (h Headers) HasToken(key, token string) bool {
+	for _, element := range h.List(key) {
+		if strings.EqualFold(element, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseList splits s on commas that are not inside a quoted-string and
+// trims the whitespace around each element. Elements are returned as they
+// appear, quotes included, since an element can carry parameters of its
+// own.
+func ParseList(s string) []string {
+	var list []string
+	start := 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == ',' && !inQuote:
+			list = appendElement(list, s[start:i])
+			start = i + 1
+		}
+	}
+	return appendElement(list, s[start:])
+}
+
+func appendElement(list []string, element string) []string {
+	element = strings.TrimSpace(element)
+	if element == "" {
+		return list
+	}
+	return append(list, element)
+}
+
+// Params returns a parameterized value such as
+// "text/html; charset=utf-8" split into the value and its parameters.
+func (h Headers) Params(key string) (string, map[string]string, error) {
+	if !h.Has(key) {
+		return "", nil, fmt.Errorf("%w: %s", ErrMissingField, key)
+	}
+	return ParseParams(h.Get(key))
+}
+
+// ParseParams splits s into its leading value and its ";"-separated
+// parameters. Parameter names are lower-cased, since they are
+// case-insensitive, and quoted values are unquoted.
+func ParseParams(s string) (string, map[string]string, error) {
+	value, rest, _ := strings.Cut(s, ";")
+	value = strings.TrimSpace(value)
+	params := make(map[string]string)
+	for {
+		rest = strings.TrimLeft(rest, " \t;")
+		if rest == "" {
+			return value, params, nil
+		}
+		name, afterName, ok := strings.Cut(rest, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || !ValidName(name) {
+			return "", nil, fmt.Errorf("%w: bad parameter in %q", ErrInvalidValue, s)
+		}
+		afterName = strings.TrimLeft(afterName, " \t")
+		var paramValue string
+		if strings.HasPrefix(afterName, `"`) {
+			unquoted, n, err := parseQuotedString(afterName)
+			if err != nil {
+				return "", nil, fmt.Errorf("%w: %q", err, s)
+			}
+			paramValue, rest = unquoted, afterName[n:]
+			rest = strings.TrimLeft(rest, " \t")
+			if rest != "" && rest[0] != ';' {
+				return "", nil, fmt.Errorf("%w: bad parameter in %q", ErrInvalidValue, s)
+			}
+		} else {
+			paramValue, rest, _ = strings.Cut(afterName, ";")
+			paramValue = strings.TrimSpace(paramValue)
+			if !ValidName(paramValue) {
+				return "", nil, fmt.Errorf("%w: bad parameter in %q", ErrInvalidValue, s)
+			}
+		}
+		params[name] = paramValue
+	}
+}
+
+// parseQuotedString reads the quoted-string at the start of s and returns
+// it unescaped along with how many bytes it took up.
+func parseQuotedString(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, fmt.Errorf("%w: unterminated quoted-string", ErrInvalidValue)
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return "", 0, fmt.Errorf("%w: unterminated quoted-string", ErrInvalidValue)
+}
+
+// QValue is one element of a quality-weighted list such as Accept-Encoding.
+type QValue struct {
+	Value  string
+	Params map[string]string
+	// Q is the weight between 0 and 1. Zero means "not acceptable", it
+	// does not mean the element can be ignored.
+	Q float64
+}
+
+// QList returns key parsed as a quality-weighted list.
+func (h Headers) QList(key string) []QValue {
+	return ParseQList(strings.Join(h.Values(key), ","))
+}
+
+// ParseQList parses a list whose elements may carry a q weight, sorted
+// from most to least preferred. Elements without a weight count as 1 and
+// ties keep the order the client sent. Malformed elements are skipped.
+func ParseQList(s string) []QValue {
+	var list []QValue
+	for _, element := range ParseList(s) {
+		value, params, err := ParseParams(element)
+		if err != nil || value == "" {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			q, ok = parseQ(raw)
+			if !ok {
+				continue
+			}
+			delete(params, "q")
+		}
+		list = append(list, QValue{Value: value, Params: params, Q: q})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Q > list[j].Q
+	})
+	return list
+}
+
+// parseQ accepts the qvalue grammar: 0 to 1 with at most three decimals.
+func parseQ(s string) (float64, bool) {
+	if len(s) == 0 || len(s) > 5 || (s[0] != '0' && s[0] != '1') {
+		return 0, false
+	}
+	if len(s) > 1 {
+		if s[1] != '.' {
+			return 0, false
+		}
+		for i := 2; i < len(s); i++ {
+			if s[i] < '0' || s[i] > '9' || (s[0] == '1' && s[i] != '0') {
+				return 0, false
+			}
+		}
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	return q, err == nil
+}
@@ -0,0 +1,238 @@
+package headers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaders_Int(t *testing.T) {
+	h := NewHeaders()
+	h.Set("Content-Length", "42")
+	n, err := h.Int("content-length")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+
+	// Test: Repeated identical values
+	h.Add("Content-Length", "42")
+	n, err = h.Int("Content-Length")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+
+	// Test: Conflicting values
+	h.Add("Content-Length", "43")
+	_, err = h.Int("Content-Length")
+	assert.ErrorIs(t, err, ErrConflictingValues)
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	// Test: Empty elements
+	for _, value := range []string{"", "42,", ", 42", "42,,42"} {
+		h.Set("Content-Length", value)
+		_, err = h.Int("Content-Length")
+		assert.ErrorIs(t, err, ErrInvalidValue, "%q", value)
+	}
+
+	// Test: Missing field
+	_, err = h.Int("Max-Forwards")
+	assert.ErrorIs(t, err, ErrMissingField)
+
+	// Test: Not plain digits
+	for _, value := range []string{"", "-1", "+1", "1.5", "0x10", "1 2", "99999999999999999999"} {
+		_, err := ParseInt(value)
+		assert.ErrorIs(t, err, ErrInvalidValue, "%q", value)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	for _, value := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseTime(value)
+		require.NoError(t, err, value)
+		assert.True(t, want.Equal(got), value)
+	}
+
+	_, err := ParseTime("yesterday")
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", FormatTime(want.In(time.FixedZone("X", 3600))))
+
+	h := NewHeaders()
+	h.Set("Last-Modified", "Sun, 06 Nov 1994 08:49:37 GMT")
+	got, err := h.Time("Last-Modified")
+	require.NoError(t, err)
+	assert.True(t, want.Equal(got))
+	_, err = h.Time("Date")
+	assert.ErrorIs(t, err, ErrMissingField)
+}
+
+func TestParseList(t *testing.T) {
+	assert.Equal(t, []string{"gzip", "br"}, ParseList("gzip, br"))
+	assert.Equal(t, []string{"a", "b"}, ParseList(" ,a,, b ,"))
+	assert.Equal(t, []string{`"a, b"`, "c"}, ParseList(`"a, b", c`))
+	assert.Equal(t, []string{`"a\", b"`, "c"}, ParseList(`"a\", b", c`))
+	assert.Nil(t, ParseList(""))
+
+	h := NewHeaders()
+	h.Add("Cache-Control", "no-cache, max-age=0")
+	h.Add("Cache-Control", "private")
+	assert.Equal(t, []string{"no-cache", "max-age=0", "private"}, h.List("cache-control"))
+}
+
+func TestHeaders_HasToken(t *testing.T) {
+	h := NewHeaders()
+	h.Add("Connection", "Keep-Alive, Upgrade")
+	h.Add("Connection", "CLOSE")
+	h.Set("Transfer-Encoding", "gzip,chunked")
+	assert.True(t, h.HasToken("connection", "keep-alive"))
+	assert.True(t, h.HasToken("Connection", "close"))
+	assert.True(t, h.HasToken("Transfer-Encoding", "chunked"))
+	assert.False(t, h.HasToken("Connection", "keep"))
+	assert.False(t, h.HasToken("Upgrade", "close"))
+}
+
+func TestParseParams(t *testing.T) {
+	value, params, err := ParseParams("text/html; charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", value)
+	assert.Equal(t, map[string]string{"charset": "utf-8"}, params)
+
+	value, params, err = ParseParams(`multipart/form-data; Boundary="a; b=\"c\""; x=y`)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", value)
+	assert.Equal(t, map[string]string{"boundary": `a; b="c"`, "x": "y"}, params)
+
+	value, params, err = ParseParams("text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", value)
+	assert.Empty(t, params)
+
+	for _, bad := range []string{
+		"text/plain; charset",
+		`text/plain; charset="utf-8`,
+		`text/plain; charset="utf-8"x`,
+		"text/plain; char set=utf-8",
+		"text/plain; charset=utf 8",
+	} {
+		_, _, err := ParseParams(bad)
+		assert.ErrorIs(t, err, ErrInvalidValue, bad)
+	}
+
+	h := NewHeaders()
+	h.Set("Content-Type", "application/json; charset=UTF-8")
+	value, params, err = h.Params("Content-Type")
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", value)
+	assert.Equal(t, "UTF-8", params["charset"])
+}
+
+func TestParseQList(t *testing.T) {
+	list := ParseQList("deflate;q=0.5, gzip, br;q=1.0, identity;q=0, *;q=0.50")
+	var values []string
+	for _, v := range list {
+		values = append(values, v.Value)
+	}
+	assert.Equal(t, []string{"gzip", "br", "deflate", "*", "identity"}, values)
+	assert.Equal(t, 0.0, list[4].Q)
+	assert.Equal(t, 0.5, list[2].Q)
+
+	// Test: Other parameters are kept, bad weights are skipped
+	list = ParseQList("text/html;level=1;q=0.7, text/plain;q=2, text/csv;q=0.1234, text/xml;q=1.5")
+	require.Len(t, list, 1)
+	assert.Equal(t, "text/html", list[0].Value)
+	assert.Equal(t, map[string]string{"level": "1"}, list[0].Params)
+
+	h := NewHeaders()
+	h.Add("Accept-Encoding", "gzip;q=0.1")
+	h.Add("Accept-Encoding", "br")
+	list = h.QList("accept-encoding")
+	require.Len(t, list, 2)
+	assert.Equal(t, "br", list[0].Value)
+}
+
+func FuzzParseList(f *testing.F) {
+	for _, seed := range []string{"gzip, br", `"a, b", c`, `"\"`, ",,,", `a="b\"c", d`} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, element := range ParseList(s) {
+			if element == "" || strings.TrimSpace(element) != element {
+				t.Fatalf("untrimmed element %q from %q", element, s)
+			}
+			if !strings.Contains(s, element) {
+				t.Fatalf("element %q not in %q", element, s)
+			}
+		}
+	})
+}
+
+func FuzzParseParams(f *testing.F) {
+	for _, seed := range []string{"text/html; charset=utf-8", `a; b="c\"d"; e=f`, `a; b="`, "a;;;", "a; =b"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		_, params, err := ParseParams(s)
+		if err != nil {
+			return
+		}
+		for name := range params {
+			if !ValidName(name) || strings.ToLower(name) != name {
+				t.Fatalf("bad parameter name %q from %q", name, s)
+			}
+		}
+	})
+}
+
+func FuzzParseQList(f *testing.F) {
+	for _, seed := range []string{"gzip;q=0.5, br", "*;q=0", "a;q=1.000", "a;q=.5", "a;q=1e0"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		list := ParseQList(s)
+		for i, v := range list {
+			if v.Q < 0 || v.Q > 1 {
+				t.Fatalf("q %v out of range from %q", v.Q, s)
+			}
+			if i > 0 && list[i-1].Q < v.Q {
+				t.Fatalf("list not sorted by q from %q", s)
+			}
+		}
+	})
+}
+
+func FuzzParseTime(f *testing.F) {
+	for _, seed := range []string{"Sun, 06 Nov 1994 08:49:37 GMT", "Sunday, 06-Nov-94 08:49:37 GMT", "Sun Nov  6 08:49:37 1994"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		tm, err := ParseTime(s)
+		if err != nil {
+			return
+		}
+		again, err := ParseTime(FormatTime(tm))
+		if err != nil || !again.Equal(tm.Truncate(time.Second)) {
+			t.Fatalf("%q does not round-trip: %v", s, err)
+		}
+	})
+}
+
+func FuzzParseInt(f *testing.F) {
+	for _, seed := range []string{"0", "42", "-1", "999999999999999999"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		n, err := ParseInt(s)
+		if err != nil {
+			return
+		}
+		if n < 0 {
+			t.Fatalf("negative %d from %q", n, s)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+// Package middleware wraps server.Handler with cross-cutting behavior such
+// as logging, auth or metrics.
+package middleware
+
+import (
+	"log"
+	"time"
+
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+	"github.com/GhostVox/httptcp/internal/server"
+)
+
+type Middleware func(server.Handler) server.Handler
+
+// Chain combines middlewares into one. The first middleware is the
+// outermost, so it sees the request first and the response last.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(h server.Handler) server.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+		return h
+	}
+}
+
+// Logging logs one line per request with the status, body size and time
+// taken. A nil logger uses the standard logger.
+func Logging(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next server.Handler) server.Handler {
+		return func(w response.Writer, req *request.Request) {
+			start := time.Now()
+			w, rec := NewResponseRecorder(w)
+			next(w, req)
+			// Finish here rather than leaving it to the server, so a
+			// buffered body is counted.
+			w.Finish()
+			logger.Printf("%s %s %d %dB %v",
+				req.RequestLine.Method,
+				req.RequestLine.RequestTarget,
+				rec.StatusCode(),
+				rec.BytesWritten(),
+				time.Since(start))
+		}
+	}
+}
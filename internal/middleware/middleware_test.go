@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+	"github.com/GhostVox/httptcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, target string) *request.Request {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func hello(w response.Writer, _ *request.Request) {
+	body := "hello"
+	w.WriteStatusLine(response.Success)
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("X-Handler", "hello")
+	w.WriteHeaders(h)
+	w.Writer.Write([]byte(body))
+}
+
+func TestChain_Order(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w response.Writer, req *request.Request) {
+				calls = append(calls, name+" in")
+				next(w, req)
+				calls = append(calls, name+" out")
+			}
+		}
+	}
+
+	h := Chain(trace("outer"), trace("inner"))(func(w response.Writer, req *request.Request) {
+		calls = append(calls, "handler")
+	})
+	h(response.NewResponse(&bytes.Buffer{}), newRequest(t, "/"))
+	assert.Equal(t, []string{"outer in", "inner in", "handler", "inner out", "outer out"}, calls)
+
+	// Test: An empty chain returns the handler unchanged
+	calls = nil
+	Chain()(hello)(response.NewResponse(&bytes.Buffer{}), newRequest(t, "/"))
+	assert.Empty(t, calls)
+}
+
+func TestResponseRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	w, rec := NewResponseRecorder(response.NewResponse(&buf))
+	assert.Equal(t, response.StatusCode(0), rec.StatusCode())
+	assert.Nil(t, rec.Headers())
+
+	hello(w, newRequest(t, "/"))
+	assert.Equal(t, response.Success, rec.StatusCode())
+	assert.Equal(t, "hello", rec.Headers().Get("X-Handler"))
+	assert.Equal(t, int64(len("hello")), rec.BytesWritten())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+}
+
+func TestLogging(t *testing.T) {
+	var logs bytes.Buffer
+	h := Logging(log.New(&logs, "", 0))(hello)
+	h(response.NewResponse(&bytes.Buffer{}), newRequest(t, "/greet"))
+	assert.True(t, strings.HasPrefix(logs.String(), "GET /greet 200 5B "), logs.String())
+}
+
+func TestLogging_BufferedBody(t *testing.T) {
+	var logs, out bytes.Buffer
+	h := Logging(log.New(&logs, "", 0))(func(w response.Writer, _ *request.Request) {
+		w.Write([]byte("buffered"))
+	})
+	h(response.NewResponse(&out), newRequest(t, "/buffered"))
+	assert.True(t, strings.HasPrefix(logs.String(), "GET /buffered 200 8B "), logs.String())
+	assert.True(t, strings.HasSuffix(out.String(), "\r\n\r\nbuffered"))
+}
+
+func TestResponseRecorder_ReadFrom(t *testing.T) {
+	var out bytes.Buffer
+	w, rec := NewResponseRecorder(response.NewResponse(&out))
+	w.WriteStatusLine(response.Success)
+	w.WriteHeaders(response.GetDefaultHeaders(6))
+	n, err := io.Copy(w, strings.NewReader("copied"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+	assert.Equal(t, int64(6), rec.BytesWritten())
+	assert.True(t, strings.HasSuffix(out.String(), "\r\n\r\ncopied"))
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+	"github.com/GhostVox/httptcp/internal/response"
+)
+
+// ResponseRecorder lets middleware see what a handler wrote: the status,
+// the headers and how many body bytes went out.
+type ResponseRecorder struct {
+	w       response.Writer
+	counter *countingWriter
+}
+
+// NewResponseRecorder returns a Writer to hand to the next handler and a
+// recorder observing it. The returned Writer shares its state with w, so
+// either can be used to write the response.
+func NewResponseRecorder(w response.Writer) (response.Writer, *ResponseRecorder) {
+	rec := &ResponseRecorder{w: w}
+	rec.counter = &countingWriter{w: w.Writer, rec: rec}
+	wrapped := w
+	wrapped.Writer = rec.counter
+	return wrapped, rec
+}
+
+// StatusCode returns the status the handler wrote, or 0 if it wrote none.
+func (r *ResponseRecorder) StatusCode() response.StatusCode {
+	return r.w.StatusCode()
+}
+
+// Headers returns the headers the handler wrote, or nil.
+func (r *ResponseRecorder) Headers() headers.Headers {
+	return r.w.Headers()
+}
+
+// BytesWritten returns the number of bytes written after the headers,
+// which includes chunk framing and trailers for chunked responses.
+func (r *ResponseRecorder) BytesWritten() int64 {
+	return r.counter.n
+}
+
+type countingWriter struct {
+	w   io.Writer
+	rec *ResponseRecorder
+	n   int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if c.rec.w.HeadersWritten() {
+		c.n += int64(n)
+	}
+	return n, err
+}
+
+// ReadFrom keeps Writer.ReadFrom's sendfile path open through the
+// recorder: the copy goes to the wrapped writer's own ReadFrom.
+func (c *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(c.w, r)
+	if c.rec.w.HeadersWritten() {
+		c.n += n
+	}
+	return n, err
+}
@@ -0,0 +1,123 @@
+package request
+
+import (
+	"errors"
+	"io"
+)
+
+// maxDrainBytes bounds how much unread body Close is willing to throw away
+// to keep the connection usable. Past that it is cheaper to hang up.
+const maxDrainBytes = 256 << 10
+
+var (
+	ErrBodyReadAfterClose = errors.New("read on closed request body")
+	ErrBodyNotDrained     = errors.New("unread request body too large to discard")
+)
+
+// body reads a Content-Length delimited body off the connection, starting
+// with whatever the Reader already buffered past the headers.
+type body struct {
+	rd        *Reader
+	remaining int64
+	closed    bool
+	err       error
+}
+
+// newBody sets up the body reader for the framing the headers declared.
+func (rd *Reader) newBody(r *Request) (io.ReadCloser, error) {
+	f, err := messageFraming(r)
+	if err != nil {
+		return nil, err
+	}
+	switch f.kind {
+	case framingChunked:
+		return &chunkedBody{
+			rd:          rd,
+			trailers:    r.Trailers,
+			maxBody:     r.config.MaxBodyBytes,
+			maxTrailers: r.config.MaxHeaderBytes,
+		}, nil
+	case framingLength:
+		if f.length > r.config.MaxBodyBytes {
+			return nil, ErrBodyTooLarge
+		}
+		if f.length == 0 {
+			rd.finishBody()
+		}
+		return &body{rd: rd, remaining: f.length}, nil
+	default:
+		rd.finishBody()
+		return &body{rd: rd}, nil
+	}
+}
+
+// HasBody reports whether the headers announce a body: a chunked one or a
+// Content-Length other than zero. Requests with framing that does not
+// parse count as having one.
+func (r *Request) HasBody() bool {
+	f, err := messageFraming(r)
+	return err != nil || f.kind == framingChunked || f.length > 0
+}
+
+// drain discards what is left of a body, giving up past maxDrainBytes.
+func drain(r io.Reader) error {
+	n, err := io.CopyN(io.Discard, r, maxDrainBytes+1)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if n > maxDrainBytes {
+		return ErrBodyNotDrained
+	}
+	return nil
+}
+
+// read serves buffered bytes first and only then goes to the connection.
+func (rd *Reader) read(p []byte) (int, error) {
+	if rd.readToIndex > 0 {
+		n := copy(p, rd.buf[:rd.readToIndex])
+		copy(rd.buf, rd.buf[n:rd.readToIndex])
+		rd.readToIndex -= n
+		return n, nil
+	}
+	return rd.reader.Read(p)
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyReadAfterClose
+	}
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.rd.read(p)
+	b.remaining -= int64(n)
+	if b.remaining == 0 {
+		b.rd.finishBody()
+	}
+	if errors.Is(err, io.EOF) && b.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Close discards the unread part of the body so the next request on the
+// connection can be parsed. It fails if too much is left to be worth reading
+// or the connection broke while draining.
+func (b *body) Close() error {
+	if b.closed {
+		return b.err
+	}
+	if b.remaining > maxDrainBytes {
+		b.err = ErrBodyNotDrained
+	} else {
+		b.err = drain(b)
+	}
+	b.closed = true
+	return b.err
+}
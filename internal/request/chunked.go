@@ -0,0 +1,186 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+)
+
+type chunkedState int
+
+const (
+	chunkedSize chunkedState = iota
+	chunkedData
+	chunkedDataEnd
+	chunkedTrailers
+	chunkedDone
+)
+
+// maxChunkSizeDigits keeps chunk sizes within an int64.
+const maxChunkSizeDigits = 15
+
+// chunkedBody decodes a chunked request body as described in RFC 9112
+// section 7.1. Chunk extensions are accepted and ignored, and the trailer
+// section is parsed into the request's Trailers.
+type chunkedBody struct {
+	rd        *Reader
+	trailers  headers.Headers
+	state     chunkedState
+	remaining int64
+	closed    bool
+	err       error
+
+	read         int64
+	maxBody      int64
+	trailerBytes int
+	maxTrailers  int
+}
+
+func (cb *chunkedBody) Read(p []byte) (int, error) {
+	if cb.closed {
+		return 0, ErrBodyReadAfterClose
+	}
+	if cb.err != nil {
+		return 0, cb.err
+	}
+	for {
+		switch cb.state {
+		case chunkedSize:
+			line, err := cb.readLine()
+			if err != nil {
+				return 0, cb.fail(err)
+			}
+			size, err := parseChunkSize(line)
+			if err != nil {
+				return 0, cb.fail(err)
+			}
+			if size == 0 {
+				cb.state = chunkedTrailers
+				continue
+			}
+			if size > cb.maxBody-cb.read {
+				return 0, cb.fail(ErrBodyTooLarge)
+			}
+			cb.read += size
+			cb.remaining = size
+			cb.state = chunkedData
+		case chunkedData:
+			if len(p) == 0 {
+				return 0, nil
+			}
+			if int64(len(p)) > cb.remaining {
+				p = p[:cb.remaining]
+			}
+			n, err := cb.rd.read(p)
+			cb.remaining -= int64(n)
+			if cb.remaining == 0 {
+				cb.state = chunkedDataEnd
+			}
+			if err != nil && (n == 0 || !errors.Is(err, io.EOF)) {
+				return n, cb.fail(err)
+			}
+			return n, nil
+		case chunkedDataEnd:
+			line, err := cb.readLine()
+			if err != nil {
+				return 0, cb.fail(err)
+			}
+			if len(line) != 0 {
+				return 0, cb.fail(fmt.Errorf("chunk data longer than chunk size"))
+			}
+			cb.state = chunkedSize
+		case chunkedTrailers:
+			if err := checkHeaderLine(cb.rd.buf[:cb.rd.readToIndex]); err != nil {
+				return 0, cb.fail(err)
+			}
+			n, done, err := cb.trailers.Parse(cb.rd.buf[:cb.rd.readToIndex])
+			if err != nil {
+				return 0, cb.fail(fmt.Errorf("invalid trailer: %w", err))
+			}
+			cb.rd.consume(n)
+			cb.trailerBytes += n
+			if cb.trailerBytes > cb.maxTrailers ||
+				(n == 0 && cb.trailerBytes+cb.rd.readToIndex > cb.maxTrailers) {
+				return 0, cb.fail(ErrHeadersTooLarge)
+			}
+			if done {
+				cb.state = chunkedDone
+				cb.rd.finishBody()
+				continue
+			}
+			if n == 0 {
+				if n, err := cb.rd.fill(); err != nil && n == 0 {
+					return 0, cb.fail(err)
+				}
+			}
+		case chunkedDone:
+			return 0, io.EOF
+		}
+	}
+}
+
+// readLine returns the next CRLF terminated line without the CRLF, reading
+// from the connection until one is buffered.
+func (cb *chunkedBody) readLine() ([]byte, error) {
+	rd := cb.rd
+	for {
+		if err := checkLine(rd.buf[:rd.readToIndex]); err != nil {
+			return nil, err
+		}
+		idx := bytes.Index(rd.buf[:rd.readToIndex], []byte(crlf))
+		if idx != -1 {
+			line := bytes.Clone(rd.buf[:idx])
+			rd.consume(idx + len(crlf))
+			return line, nil
+		}
+		if rd.readToIndex > maxChunkLineBytes {
+			return nil, fmt.Errorf("chunk line too long")
+		}
+		n, err := rd.fill()
+		if err != nil && n == 0 {
+			return nil, err
+		}
+	}
+}
+
+// fail records a broken body so later reads keep failing. A connection that
+// ends mid-body is reported as io.ErrUnexpectedEOF.
+func (cb *chunkedBody) fail(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	cb.err = err
+	return err
+}
+
+func parseChunkSize(line []byte) (int64, error) {
+	size, _, _ := bytes.Cut(line, []byte(";"))
+	size = bytes.TrimRight(size, " \t")
+	if len(size) == 0 || len(size) > maxChunkSizeDigits {
+		return 0, fmt.Errorf("invalid chunk size: %q", line)
+	}
+	// ParseInt would also take a sign, which is not valid here.
+	for _, c := range size {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return 0, fmt.Errorf("invalid chunk size: %q", line)
+		}
+	}
+	return strconv.ParseInt(string(size), 16, 64)
+}
+
+func (cb *chunkedBody) Close() error {
+	if cb.closed {
+		return cb.err
+	}
+	if cb.err == nil {
+		if err := drain(cb); err != nil {
+			cb.err = err
+		}
+	}
+	cb.closed = true
+	return cb.err
+}
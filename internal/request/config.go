@@ -0,0 +1,63 @@
+package request
+
+import "errors"
+
+const (
+	DefaultMaxRequestLineBytes = 8 << 10
+	DefaultMaxHeaderBytes      = 64 << 10
+	DefaultMaxHeaderCount      = 100
+	DefaultMaxBodyBytes        = 32 << 20
+)
+
+// maxChunkLineBytes bounds a chunk-size line including its extensions.
+const maxChunkLineBytes = 4 << 10
+
+// These errors are returned when a request exceeds its ParserConfig. The
+// server maps them to 414, 431 and 413 respectively.
+var (
+	ErrRequestLineTooLong = errors.New("request-line too long")
+	ErrHeadersTooLarge    = errors.New("header section too large")
+	ErrTooManyHeaders     = errors.New("too many header fields")
+	ErrBodyTooLarge       = errors.New("request body too large")
+)
+
+// ParserConfig bounds how much a client may make the parser hold on to.
+// Zero fields fall back to the package defaults.
+type ParserConfig struct {
+	// MaxRequestLineBytes limits the request-line, excluding the CRLF.
+	MaxRequestLineBytes int
+	// MaxHeaderBytes limits the header section, and separately the
+	// trailer section of a chunked body, including line endings.
+	MaxHeaderBytes int
+	// MaxHeaderCount limits the number of header field lines.
+	MaxHeaderCount int
+	// MaxBodyBytes limits the decoded body, whether framed by
+	// Content-Length or chunked encoding.
+	MaxBodyBytes int64
+}
+
+func DefaultParserConfig() ParserConfig {
+	return ParserConfig{
+		MaxRequestLineBytes: DefaultMaxRequestLineBytes,
+		MaxHeaderBytes:      DefaultMaxHeaderBytes,
+		MaxHeaderCount:      DefaultMaxHeaderCount,
+		MaxBodyBytes:        DefaultMaxBodyBytes,
+	}
+}
+
+func (c ParserConfig) withDefaults() ParserConfig {
+	d := DefaultParserConfig()
+	if c.MaxRequestLineBytes <= 0 {
+		c.MaxRequestLineBytes = d.MaxRequestLineBytes
+	}
+	if c.MaxHeaderBytes <= 0 {
+		c.MaxHeaderBytes = d.MaxHeaderBytes
+	}
+	if c.MaxHeaderCount <= 0 {
+		c.MaxHeaderCount = d.MaxHeaderCount
+	}
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = d.MaxBodyBytes
+	}
+	return c
+}
@@ -0,0 +1,104 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+)
+
+// These errors reject messages whose framing could be read differently by
+// another hop, which is what request smuggling relies on.
+var (
+	ErrBareLF                        = errors.New("bare LF in message")
+	ErrBareCR                        = errors.New("bare CR in message")
+	ErrObsFold                       = errors.New("obsolete line folding is not allowed")
+	ErrInvalidContentLength          = errors.New("invalid content-length")
+	ErrConflictingContentLength      = errors.New("conflicting content-length values")
+	ErrContentLengthWithTransferCode = errors.New("both content-length and transfer-encoding present")
+	ErrUnsupportedTransferEncoding   = errors.New("unsupported transfer-encoding")
+	ErrTransferEncodingHTTP10        = errors.New("transfer-encoding in an HTTP/1.0 request")
+)
+
+type framingKind int
+
+const (
+	framingNone framingKind = iota
+	framingLength
+	framingChunked
+)
+
+type framing struct {
+	kind   framingKind
+	length int64
+}
+
+// checkLine looks at the next line in data and rejects line endings other
+// than CRLF. Lines that are not complete yet are left for later.
+func checkLine(data []byte) error {
+	idx := bytes.IndexByte(data, '\n')
+	if idx == -1 {
+		idx = len(data)
+	} else if idx == 0 || data[idx-1] != '\r' {
+		return ErrBareLF
+	}
+	if cr := bytes.IndexByte(data[:idx], '\r'); cr != -1 && cr != idx-1 {
+		return ErrBareCR
+	}
+	return nil
+}
+
+// checkHeaderLine is checkLine plus the obs-fold rule: a field line may not
+// start with whitespace, since hops disagree on whether it continues the
+// previous field.
+func checkHeaderLine(data []byte) error {
+	if len(data) > 0 && (data[0] == ' ' || data[0] == '\t') {
+		return ErrObsFold
+	}
+	return checkLine(data)
+}
+
+// messageFraming decides how the body is delimited, following RFC 9112
+// section 6.3. Anything ambiguous is an error rather than a guess.
+func messageFraming(r *Request) (framing, error) {
+	h := r.Headers
+	hasTE := h.Has("Transfer-Encoding")
+	hasCL := h.Has("Content-Length")
+	// HTTP/1.0 has no transfer codings, so whoever sent one is confused
+	// about framing and the message cannot be trusted (RFC 9112 6.1).
+	if hasTE && r.IsHTTP10() {
+		return framing{}, ErrTransferEncodingHTTP10
+	}
+	if hasTE && hasCL {
+		return framing{}, ErrContentLengthWithTransferCode
+	}
+	if hasTE {
+		if err := checkTransferEncoding(h.Get("Transfer-Encoding")); err != nil {
+			return framing{}, err
+		}
+		return framing{kind: framingChunked}, nil
+	}
+	if hasCL {
+		length, err := h.Int("Content-Length")
+		switch {
+		case errors.Is(err, headers.ErrConflictingValues):
+			return framing{}, fmt.Errorf("%w: %q", ErrConflictingContentLength, h.Get("Content-Length"))
+		case err != nil:
+			return framing{}, fmt.Errorf("%w: %q", ErrInvalidContentLength, h.Get("Content-Length"))
+		}
+		return framing{kind: framingLength, length: length}, nil
+	}
+	return framing{kind: framingNone}, nil
+}
+
+// checkTransferEncoding only accepts a lone chunked coding; it is the only
+// one we can decode, and chunked must be applied exactly once and last.
+func checkTransferEncoding(value string) error {
+	codings := strings.Split(value, ",")
+	if len(codings) != 1 || !strings.EqualFold(strings.TrimSpace(codings[0]), "chunked") {
+		return fmt.Errorf("%w: %q", ErrUnsupportedTransferEncoding, value)
+	}
+	return nil
+}
@@ -2,10 +2,10 @@ package request
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
 
 	"github.com/GhostVox/httptcp/internal/headers"
@@ -13,9 +13,53 @@ import (
 
 type Request struct {
 	RequestLine RequestLine
-	state       state
-	Headers     headers.Headers
-	Body        []byte
+	// URL is RequestLine.RequestTarget parsed. Handlers should route and
+	// match on URL.Path rather than on the raw target.
+	URL     *URL
+	state   state
+	Headers headers.Headers
+	// Body streams the request body straight from the connection. It is
+	// never nil; requests without a body return io.EOF immediately.
+	Body io.ReadCloser
+	// Trailers holds the trailer section of a chunked body. It is only
+	// filled in once Body has returned io.EOF.
+	Trailers headers.Headers
+
+	ctx         context.Context
+	config      ParserConfig
+	headerBytes int
+	headerCount int
+}
+
+// Path returns the path to route on: URL.Path when the parser filled in
+// URL, otherwise the raw target without its query, for requests that were
+// not built by the parser.
+func (r *Request) Path() string {
+	if r.URL != nil {
+		return r.URL.Path
+	}
+	path, _, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	return path
+}
+
+// Context returns the request's context. Servers cancel it when the client
+// goes away or the server shuts down.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of r with its context changed to ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r2 := new(Request)
+	*r2 = *r
+	r2.ctx = ctx
+	return r2
 }
 
 type RequestLine struct {
@@ -36,46 +80,157 @@ const buffSize int = 8
 
 const crlf = "\r\n"
 
+// RequestFromReader reads a single request from reader. If the reader is
+// exhausted before any bytes of a new request arrive, io.EOF is returned
+// unwrapped so connection loops can tell a clean close from a bad request.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, buffSize, buffSize)
+	return NewReader(reader).ReadRequest()
+}
 
-	readToIndex := 0
-	request := &Request{
-		state:   requestIntialized,
-		Headers: headers.NewHeaders(),
+// Reader parses successive requests from one connection. Bytes read past the
+// end of a request stay in the buffer and are parsed as the start of the next
+// one, which is what lets clients pipeline requests.
+type Reader struct {
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+	// current is the body of the last request handed out. It has to be
+	// drained before the next request line can be found.
+	current io.Closer
+	config  ParserConfig
+	// bodyDone is closed once the current body has been read to the end,
+	// after which nothing but the next request can arrive.
+	bodyDone     chan struct{}
+	bodyFinished bool
+	// httpVersion is the version from the last request line parsed.
+	httpVersion string
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return NewReaderWithConfig(reader, DefaultParserConfig())
+}
+
+func NewReaderWithConfig(reader io.Reader, config ParserConfig) *Reader {
+	return &Reader{
+		reader: reader,
+		buf:    make([]byte, buffSize, buffSize),
+		config: config.withDefaults(),
 	}
-	for request.state != requestDone {
-		if readToIndex >= len(buf) {
-			newBuff := make([]byte, len(buf)*2)
-			copy(newBuff, buf)
-			buf = newBuff
+}
+
+// Buffered returns the number of bytes already read from the connection that
+// belong to requests which have not been parsed yet.
+func (rd *Reader) Buffered() int {
+	return rd.readToIndex
+}
+
+// fill reads more from the connection into the buffer, growing it when it is
+// already full.
+func (rd *Reader) fill() (int, error) {
+	if rd.readToIndex >= len(rd.buf) {
+		newBuff := make([]byte, len(rd.buf)*2)
+		copy(newBuff, rd.buf)
+		rd.buf = newBuff
+	}
+	n, err := rd.reader.Read(rd.buf[rd.readToIndex:])
+	rd.readToIndex += n
+	return n, err
+}
+
+// WaitForData blocks until at least one byte of the next request is
+// buffered. Servers use it to apply an idle timeout before the request
+// starts, and to notice a client hanging up while a handler runs.
+func (rd *Reader) WaitForData() error {
+	for rd.readToIndex == 0 {
+		n, err := rd.fill()
+		if n > 0 {
+			return nil
 		}
-		n, err := reader.Read(buf[readToIndex:])
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if request.state != requestDone {
-					return nil, fmt.Errorf("unexpected EOF")
-				}
+			return err
+		}
+	}
+	return nil
+}
 
-				if request.RequestLine == (RequestLine{}) {
-					return nil, fmt.Errorf("no request-line found")
-				}
-				break
+// BodyDone returns a channel that is closed once the body of the last
+// request returned by ReadRequest has been read to the end.
+func (rd *Reader) BodyDone() <-chan struct{} {
+	return rd.bodyDone
+}
 
-			}
-			return nil, fmt.Errorf("error reading from reader: %w", err)
+func (rd *Reader) finishBody() {
+	if !rd.bodyFinished {
+		rd.bodyFinished = true
+		close(rd.bodyDone)
+	}
+}
+
+// HTTPVersion returns the version from the request line of the last
+// request read, even one whose headers then failed to parse, so the error
+// response can be written in a form the client understands. It is empty
+// if no request line was parsed.
+func (rd *Reader) HTTPVersion() string {
+	return rd.httpVersion
+}
+
+func (rd *Reader) consume(n int) {
+	copy(rd.buf, rd.buf[n:rd.readToIndex])
+	rd.readToIndex -= n
+}
+
+// ReadRequest parses the request line and headers of the next request. The
+// body is left on the connection and read through Request.Body; whatever the
+// caller did not read of the previous body is discarded first.
+func (rd *Reader) ReadRequest() (*Request, error) {
+	if rd.current != nil {
+		if err := rd.current.Close(); err != nil {
+			return nil, err
 		}
-		readToIndex += n
-		bytesParsed, err := request.parse(buf[:readToIndex])
+		rd.current = nil
+	}
+	request := &Request{
+		state:    requestIntialized,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		config:   rd.config,
+	}
+	defer func() {
+		rd.httpVersion = request.RequestLine.HttpVersion
+	}()
+	for {
+		bytesParsed, err := request.parse(rd.buf[:rd.readToIndex])
 		if err != nil {
 			return nil, fmt.Errorf("error parsing request: %w", err)
 		}
-		copy(buf, buf[bytesParsed:])
-		readToIndex -= bytesParsed
+		rd.consume(bytesParsed)
+		if request.state == requestParsingBody {
+			rd.bodyDone = make(chan struct{})
+			rd.bodyFinished = false
+			b, err := rd.newBody(request)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing request: %w", err)
+			}
+			request.Body = b
+			request.state = requestDone
+			rd.current = b
+			return request, nil
+		}
 
+		n, err := rd.fill()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("error reading from reader: %w", err)
+			}
+			if n > 0 {
+				continue
+			}
+			if request.state == requestIntialized && rd.readToIndex == 0 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("unexpected EOF")
+		}
 	}
-	return request, nil
-
 }
 
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
@@ -116,7 +271,7 @@ func requestLineFromString(str string) (*RequestLine, error) {
 		return nil, fmt.Errorf("unrecognized HTTP-version: %s", httpPart)
 	}
 	version := versionParts[1]
-	if version != "1.1" {
+	if version != "1.1" && version != "1.0" {
 		return nil, fmt.Errorf("unrecognized HTTP-version: %s", version)
 	}
 
@@ -127,9 +282,33 @@ func requestLineFromString(str string) (*RequestLine, error) {
 	}, nil
 }
 
+// IsHTTP10 reports whether the request was sent as HTTP/1.0, which has no
+// chunked encoding and closes connections by default.
+func (r *Request) IsHTTP10() bool {
+	return r.RequestLine.HttpVersion == "1.0"
+}
+
+// KeepAlive reports whether the client is willing to reuse the connection:
+// HTTP/1.1 unless it sent "Connection: close", HTTP/1.0 only if it sent
+// "Connection: keep-alive".
+func (r *Request) KeepAlive() bool {
+	if r.IsHTTP10() {
+		return r.Headers.HasToken("Connection", "keep-alive")
+	}
+	return !r.Headers.HasToken("Connection", "close")
+}
+
+// ReadBody reads the whole body into memory. It is meant for handlers that
+// expect small bodies; anything large should read from Body directly.
+func (r *Request) ReadBody() ([]byte, error) {
+	return io.ReadAll(r.Body)
+}
+
+// parse consumes the request line and headers. The body is not parsed here,
+// it is streamed by Body once the headers are done.
 func (r *Request) parse(data []byte) (int, error) {
 	totalBytesParsed := 0
-	for r.state != requestDone {
+	for r.state == requestIntialized || r.state == requestStateParsingHeaders {
 		bytesParsed, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
 			return 0, err
@@ -142,51 +321,73 @@ func (r *Request) parse(data []byte) (int, error) {
 	return totalBytesParsed, nil
 }
 
+// countHeaderBytes enforces the header limits. A line that is still
+// incomplete counts against the byte limit too, otherwise a client could
+// stream one endless field.
+func (r *Request) countHeaderBytes(bytesParsed int, done bool, buffered int) error {
+	if bytesParsed == 0 {
+		if r.headerBytes+buffered > r.config.MaxHeaderBytes {
+			return ErrHeadersTooLarge
+		}
+		return nil
+	}
+	r.headerBytes += bytesParsed
+	if r.headerBytes > r.config.MaxHeaderBytes {
+		return ErrHeadersTooLarge
+	}
+	if !done {
+		r.headerCount++
+		if r.headerCount > r.config.MaxHeaderCount {
+			return ErrTooManyHeaders
+		}
+	}
+	return nil
+}
+
 func (r *Request) parseSingle(data []byte) (int, error) {
 	switch r.state {
 	case requestIntialized:
+		if err := checkLine(data); err != nil {
+			return 0, err
+		}
 		requestLine, bytesParsed, err := parseRequestLine(data)
 		if err != nil {
 			return 0, err
 		}
 		if bytesParsed == 0 {
+			if len(data) > r.config.MaxRequestLineBytes+len(crlf) {
+				return 0, ErrRequestLineTooLong
+			}
 			return bytesParsed, nil
 		}
+		if bytesParsed > r.config.MaxRequestLineBytes+len(crlf) {
+			return 0, ErrRequestLineTooLong
+		}
+		u, err := parseTarget(requestLine.Method, requestLine.RequestTarget)
+		if err != nil {
+			return 0, err
+		}
 		r.RequestLine = *requestLine
+		r.URL = u
 		r.state = requestStateParsingHeaders
 		return bytesParsed, nil
 	case requestStateParsingHeaders:
+		if err := checkHeaderLine(data); err != nil {
+			return 0, err
+		}
 		bytesParsed, done, err := r.Headers.Parse(data)
 		if err != nil {
 			return 0, err
 		}
+		if err := r.countHeaderBytes(bytesParsed, done, len(data)); err != nil {
+			return 0, err
+		}
 		if done {
 			r.state = requestParsingBody
 		}
 		return bytesParsed, nil
-	case requestParsingBody:
-		contentLength := r.Headers.Get("Content-Length")
-		if contentLength == "" {
-			r.state = requestDone
-			return 0, nil
-		}
-		cLength, err := strconv.Atoi(contentLength)
-		if err != nil {
-			return 0, fmt.Errorf("invalid content-length: %s", contentLength)
-		}
-		fmt.Println("Content-Length: ", cLength, "data: ", data)
-		r.Body = append(r.Body, data...)
-		if len(r.Body) > cLength {
-			return 0, fmt.Errorf("body is larger than content-length")
-		}
-		if cLength == len(r.Body) {
-			r.state = requestDone
-		}
-		fmt.Printf("Content-Length: %d, BodyLength: %d", cLength, len(r.Body))
-		return len(data), nil
-
-	case requestDone:
-		return 0, fmt.Errorf("trying to read data in done state")
+	case requestParsingBody, requestDone:
+		return 0, fmt.Errorf("trying to parse data after headers")
 
 	default:
 		return 0, fmt.Errorf("unknown state: %d", r.state)
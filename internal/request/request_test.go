@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -44,10 +45,19 @@ func TestRequestLineParser(t *testing.T) {
 		},
 		{
 			name:            "Invalid HTTP version",
-			input:           "GET / HTTP/1.0\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+			input:           "GET / HTTP/2.0\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
 			expectError:     true,
 			numBytesPerRead: 4,
 		},
+		{
+			name:            "Valid HTTP/1.0 request",
+			input:           "GET / HTTP/1.0\r\nUser-Agent: health-check\r\n\r\n",
+			numBytesPerRead: 4,
+			expectError:     false,
+			method:          "GET",
+			target:          "/",
+			version:         "1.0",
+		},
 		{
 			name:            "Invalid request line parts",
 			input:           "GET / HTTP/1.1 extra\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
@@ -101,9 +111,9 @@ func TestHeaders_Parse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+	assert.Equal(t, "*/*", r.Headers.Get("accept"))
 
 	// Test: Empty Headers
 	reader = &chunkReader{
@@ -123,7 +133,7 @@ func TestHeaders_Parse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, localhost:42070", r.Headers["host"])
+	assert.Equal(t, "localhost:42069, localhost:42070", r.Headers.Get("host"))
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -133,7 +143,7 @@ func TestHeaders_Parse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, localhost:42070", r.Headers["host"])
+	assert.Equal(t, "localhost:42069, localhost:42070", r.Headers.Get("host"))
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
@@ -167,7 +177,9 @@ func TestBody_Parse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
 
 	// Test: Empty Body, 0 reported content length (valid)
 	reader = &chunkReader{
@@ -180,7 +192,9 @@ func TestBody_Parse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "", string(body))
 
 	// Test: Empty Body, no content length header (valid)
 	reader = &chunkReader{
@@ -192,7 +206,9 @@ func TestBody_Parse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "", string(body))
 
 	// Test: Body shorter than reported content length (should error)
 	reader = &chunkReader{
@@ -204,7 +220,9 @@ func TestBody_Parse(t *testing.T) {
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
-	require.Error(t, err)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
 
 	// Test: No content-length header, body exists (shouldn't error even though we are assuming content-length will be set if body present)
 	reader = &chunkReader{
@@ -217,7 +235,9 @@ func TestBody_Parse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "", string(body))
 
 }
 
@@ -245,3 +265,330 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	}
 	return n, nil
 }
+
+func TestReader_Pipelined(t *testing.T) {
+	reader := NewReader(&chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /second HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 64,
+	})
+
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Greater(t, reader.Buffered(), 0)
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.Equal(t, 0, reader.Buffered())
+
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestBody_Stream(t *testing.T) {
+	// Test: Body is read lazily and never past Content-Length
+	reader := NewReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 10\r\n" +
+			"\r\n" +
+			"0123456789" +
+			"GET /next HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 4,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	n, err := r.Body.Read(buf)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(buf[:n])+string(rest))
+	require.NoError(t, r.Body.Close())
+	_, err = r.Body.Read(buf)
+	assert.ErrorIs(t, err, ErrBodyReadAfterClose)
+
+	// Test: Unread body is discarded before the next request
+	reader = NewReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Length: 10\r\n" +
+			"\r\n" +
+			"0123456789" +
+			"GET /next HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	_, err = reader.ReadRequest()
+	require.NoError(t, err)
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Invalid content length
+	reader = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	_, err = reader.ReadRequest()
+	require.Error(t, err)
+}
+
+func TestChunkedBody_Parse(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		numBytesPerRead int
+		expectError     bool
+		body            string
+		trailers        map[string]string
+	}{
+		{
+			name: "Valid chunked body",
+			input: "POST /submit HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"5\r\nhello\r\n" +
+				"7\r\n world!\r\n" +
+				"0\r\n" +
+				"\r\n",
+			numBytesPerRead: 1,
+			body:            "hello world!",
+		},
+		{
+			name: "Chunk extensions and hex sizes",
+			input: "POST /submit HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"A;name=value\r\n0123456789\r\n" +
+				"1 ; quoted=\"a;b\"\r\n!\r\n" +
+				"0;last\r\n" +
+				"\r\n",
+			numBytesPerRead: 1,
+			body:            "0123456789!",
+		},
+		{
+			name: "Trailers",
+			input: "POST /submit HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"Trailer: X-Checksum\r\n" +
+				"\r\n" +
+				"3\r\nabc\r\n" +
+				"0\r\n" +
+				"X-Checksum: 900150983cd24fb0\r\n" +
+				"X-Other: yes\r\n" +
+				"\r\n",
+			numBytesPerRead: 1,
+			body:            "abc",
+			trailers:        map[string]string{"x-checksum": "900150983cd24fb0", "x-other": "yes"},
+		},
+		{
+			name: "Invalid chunk size",
+			input: "POST /submit HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"+5\r\nhello\r\n0\r\n\r\n",
+			numBytesPerRead: 1,
+			expectError:     true,
+		},
+		{
+			name: "Chunk data longer than size",
+			input: "POST /submit HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"2\r\nhello\r\n0\r\n\r\n",
+			numBytesPerRead: 1,
+			expectError:     true,
+		},
+		{
+			name: "Missing last chunk",
+			input: "POST /submit HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"5\r\nhello\r\n",
+			numBytesPerRead: 1,
+			expectError:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := RequestFromReader(&chunkReader{
+				data:            tc.input,
+				numBytesPerRead: tc.numBytesPerRead,
+			})
+			require.NoError(t, err)
+			body, err := r.ReadBody()
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.body, string(body))
+			for key, value := range tc.trailers {
+				assert.Equal(t, value, r.Trailers.Get(key))
+			}
+		})
+	}
+
+	// Test: Request after a chunked body on the same connection
+	reader := NewReader(&chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n0\r\n\r\n" +
+			"GET /second HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 1,
+	})
+	_, err := reader.ReadRequest()
+	require.NoError(t, err)
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+}
+
+func TestParserConfig_Limits(t *testing.T) {
+	config := ParserConfig{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        8,
+	}
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{
+			name:  "Request line too long",
+			input: "GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\n\r\n",
+			err:   ErrRequestLineTooLong,
+		},
+		{
+			name:  "Request line without end",
+			input: "GET /" + strings.Repeat("a", 64),
+			err:   ErrRequestLineTooLong,
+		},
+		{
+			name:  "Header section too large",
+			input: "GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("a", 64) + "\r\n\r\n",
+			err:   ErrHeadersTooLarge,
+		},
+		{
+			name:  "Header line without end",
+			input: "GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("a", 128),
+			err:   ErrHeadersTooLarge,
+		},
+		{
+			name:  "Too many headers",
+			input: "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n",
+			err:   ErrTooManyHeaders,
+		},
+		{
+			name:  "Content-Length over limit",
+			input: "POST / HTTP/1.1\r\nContent-Length: 9\r\n\r\n123456789",
+			err:   ErrBodyTooLarge,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := NewReaderWithConfig(&chunkReader{
+				data:            tc.input,
+				numBytesPerRead: 5,
+			}, config)
+			_, err := reader.ReadRequest()
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	// Test: Chunked body over limit fails while reading
+	reader := NewReaderWithConfig(&chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n",
+		numBytesPerRead: 5,
+	}, config)
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Requests within the limits still parse
+	reader = NewReaderWithConfig(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nA: 1\r\nB: 2\r\nContent-Length: 8\r\n\r\n12345678",
+		numBytesPerRead: 5,
+	}, config)
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "12345678", string(body))
+}
+
+func TestRequest_KeepAlive(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		keepAlive bool
+	}{
+		{"HTTP/1.1 default", "GET / HTTP/1.1\r\n\r\n", true},
+		{"HTTP/1.1 close", "GET / HTTP/1.1\r\nConnection: close\r\n\r\n", false},
+		{"HTTP/1.0 default", "GET / HTTP/1.0\r\n\r\n", false},
+		{"HTTP/1.0 keep-alive", "GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := RequestFromReader(&chunkReader{data: tc.input, numBytesPerRead: 8})
+			require.NoError(t, err)
+			assert.Equal(t, tc.keepAlive, r.KeepAlive())
+		})
+	}
+
+	// Test: HTTP/1.0 has no transfer codings
+	_, err := RequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		numBytesPerRead: 8,
+	})
+	require.ErrorIs(t, err, ErrTransferEncodingHTTP10)
+}
+
+func TestRequest_HasBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		hasBody bool
+	}{
+		{"no framing", "GET / HTTP/1.1\r\n\r\n", false},
+		{"zero length", "POST / HTTP/1.1\r\nContent-Length: 0\r\n\r\n", false},
+		{"length", "POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc", true},
+		{"chunked", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := RequestFromReader(&chunkReader{data: tc.input, numBytesPerRead: 8})
+			require.NoError(t, err)
+			assert.Equal(t, tc.hasBody, r.HasBody())
+		})
+	}
+}
+
+func TestRequest_Path(t *testing.T) {
+	r, err := RequestFromReader(&chunkReader{data: "GET /a/../b%20c?x=1 HTTP/1.1\r\n\r\n", numBytesPerRead: 8})
+	require.NoError(t, err)
+	assert.Equal(t, "/b c", r.Path())
+
+	// Test: Requests built by hand fall back to the raw target
+	r = &Request{RequestLine: RequestLine{RequestTarget: "/raw?x=1"}}
+	assert.Equal(t, "/raw", r.Path())
+}
@@ -0,0 +1,217 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These requests are classic desync vectors: each one could be framed
+// differently by a proxy in front of us, so all of them must be rejected.
+func TestRequestSmuggling(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{
+			name: "CL.TE",
+			input: "POST / HTTP/1.1\r\n" +
+				"Host: localhost\r\n" +
+				"Content-Length: 13\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"0\r\n\r\nSMUGGLED",
+			err: ErrContentLengthWithTransferCode,
+		},
+		{
+			name: "TE.CL",
+			input: "POST / HTTP/1.1\r\n" +
+				"Host: localhost\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"Content-Length: 3\r\n" +
+				"\r\n" +
+				"8\r\nSMUGGLED\r\n0\r\n\r\n",
+			err: ErrContentLengthWithTransferCode,
+		},
+		{
+			name: "Conflicting duplicate Content-Length",
+			input: "POST / HTTP/1.1\r\n" +
+				"Content-Length: 5\r\n" +
+				"Content-Length: 6\r\n" +
+				"\r\n" +
+				"hello!",
+			err: ErrConflictingContentLength,
+		},
+		{
+			name: "Conflicting Content-Length list",
+			input: "POST / HTTP/1.1\r\n" +
+				"Content-Length: 5, 6\r\n" +
+				"\r\n" +
+				"hello!",
+			err: ErrConflictingContentLength,
+		},
+		{
+			name: "Signed Content-Length",
+			input: "POST / HTTP/1.1\r\n" +
+				"Content-Length: +5\r\n" +
+				"\r\n" +
+				"hello",
+			err: ErrInvalidContentLength,
+		},
+		{
+			name: "Empty Content-Length",
+			input: "POST / HTTP/1.1\r\n" +
+				"Content-Length:\r\n" +
+				"\r\n",
+			err: ErrInvalidContentLength,
+		},
+		{
+			name: "Content-Length overflow",
+			input: "POST / HTTP/1.1\r\n" +
+				"Content-Length: 99999999999999999999\r\n" +
+				"\r\n",
+			err: ErrInvalidContentLength,
+		},
+		{
+			name: "Unknown transfer coding",
+			input: "POST / HTTP/1.1\r\n" +
+				"Transfer-Encoding: gzip, chunked\r\n" +
+				"\r\n" +
+				"0\r\n\r\n",
+			err: ErrUnsupportedTransferEncoding,
+		},
+		{
+			name: "Chunked applied twice",
+			input: "POST / HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"0\r\n\r\n",
+			err: ErrUnsupportedTransferEncoding,
+		},
+		{
+			name: "Obfuscated transfer coding",
+			input: "POST / HTTP/1.1\r\n" +
+				"Transfer-Encoding: xchunked\r\n" +
+				"\r\n" +
+				"0\r\n\r\n",
+			err: ErrUnsupportedTransferEncoding,
+		},
+		{
+			name: "Bare LF in request line",
+			input: "GET / HTTP/1.1\n" +
+				"Host: localhost\r\n" +
+				"\r\n",
+			err: ErrBareLF,
+		},
+		{
+			name: "Bare LF between headers",
+			input: "GET / HTTP/1.1\r\n" +
+				"Host: localhost\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n",
+			err: ErrBareLF,
+		},
+		{
+			name: "Bare CR in header",
+			input: "GET / HTTP/1.1\r\n" +
+				"X-Foo: bar\rTransfer-Encoding: chunked\r\n" +
+				"\r\n",
+			err: ErrBareCR,
+		},
+		{
+			name: "Obs-fold continuation line",
+			input: "POST / HTTP/1.1\r\n" +
+				"Transfer-Encoding: identity\r\n" +
+				" chunked\r\n" +
+				"\r\n",
+			err: ErrObsFold,
+		},
+		{
+			name: "Tab folded Content-Length",
+			input: "POST / HTTP/1.1\r\n" +
+				"X-Foo: bar\r\n" +
+				"\tContent-Length: 5\r\n" +
+				"\r\n",
+			err: ErrObsFold,
+		},
+	}
+
+	for _, tc := range tests {
+		for _, perRead := range []int{1, 7, len(tc.input)} {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := RequestFromReader(&chunkReader{
+					data:            tc.input,
+					numBytesPerRead: perRead,
+				})
+				require.Error(t, err)
+				assert.ErrorIs(t, err, tc.err)
+			})
+		}
+	}
+}
+
+func TestRequestSmuggling_ChunkedBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{
+			name: "Bare LF after chunk size",
+			input: "POST / HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"3\nabc\r\n0\r\n\r\n",
+			err: ErrBareLF,
+		},
+		{
+			name: "Bare LF after chunk data",
+			input: "POST / HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"3\r\nabc\n0\r\n\r\n",
+			err: ErrBareLF,
+		},
+		{
+			name: "Folded trailer",
+			input: "POST / HTTP/1.1\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"0\r\n" +
+				"X-Trailer: a\r\n" +
+				" b\r\n" +
+				"\r\n",
+			err: ErrObsFold,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := RequestFromReader(&chunkReader{
+				data:            tc.input,
+				numBytesPerRead: 1,
+			})
+			require.NoError(t, err)
+			_, err = r.ReadBody()
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	// Test: Identical duplicate Content-Length values are collapsed
+	r, err := RequestFromReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
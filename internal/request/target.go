@@ -0,0 +1,275 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidTarget = errors.New("invalid request-target")
+
+// TargetForm is one of the four request-target forms of RFC 9112 section
+// 3.2.
+type TargetForm int
+
+const (
+	// OriginForm is an absolute path with an optional query: /where?q=now
+	OriginForm TargetForm = iota
+	// AbsoluteForm is a full URI, as sent to proxies: http://host/where
+	AbsoluteForm
+	// AuthorityForm is host and port, only used with CONNECT: host:443
+	AuthorityForm
+	// AsteriskForm is a lone *, only used with server-wide OPTIONS.
+	AsteriskForm
+)
+
+// URL is the parsed request-target.
+type URL struct {
+	Form TargetForm
+	// Scheme is set for absolute-form targets.
+	Scheme string
+	// Host is set for absolute-form and authority-form targets.
+	Host string
+	// Path is percent-decoded with dot-segments removed, so it is safe to
+	// compare against prefixes. Empty for authority-form and asterisk-form.
+	Path string
+	// RawPath is the path exactly as it was sent.
+	RawPath string
+	// RawQuery is the query without the leading '?', still encoded.
+	RawQuery string
+}
+
+// Query parses RawQuery. Pairs that are not validly encoded are skipped.
+func (u *URL) Query() Values {
+	values := Values{}
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		key, err := unescape(strings.ReplaceAll(key, "+", " "))
+		if err != nil {
+			continue
+		}
+		value, err = unescape(strings.ReplaceAll(value, "+", " "))
+		if err != nil {
+			continue
+		}
+		values[key] = append(values[key], value)
+	}
+	return values
+}
+
+// Values maps query keys to every value given for them, in order.
+type Values map[string][]string
+
+// Get returns the first value for key, or "".
+func (v Values) Get(key string) string {
+	if vs := v[key]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+// parseTarget classifies and validates target. The form has to agree with
+// the method: CONNECT takes authority-form only, and asterisk-form is only
+// allowed for OPTIONS.
+func parseTarget(method, target string) (*URL, error) {
+	if target == "" {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidTarget)
+	}
+	for i := 0; i < len(target); i++ {
+		if c := target[i]; c <= ' ' || c == 0x7f || c == '#' {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTarget, target)
+		}
+	}
+
+	switch {
+	case method == "CONNECT":
+		if !validAuthority(target, true) {
+			return nil, fmt.Errorf("%w: CONNECT needs host:port, got %q", ErrInvalidTarget, target)
+		}
+		return &URL{Form: AuthorityForm, Host: target}, nil
+	case target == "*":
+		if method != "OPTIONS" {
+			return nil, fmt.Errorf("%w: * is only allowed with OPTIONS", ErrInvalidTarget)
+		}
+		return &URL{Form: AsteriskForm}, nil
+	case strings.HasPrefix(target, "/"):
+		u := &URL{Form: OriginForm}
+		if err := u.setPathAndQuery(target); err != nil {
+			return nil, err
+		}
+		return u, nil
+	default:
+		return parseAbsoluteForm(target)
+	}
+}
+
+func parseAbsoluteForm(target string) (*URL, error) {
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok || !validScheme(scheme) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTarget, target)
+	}
+	authority, pathAndQuery := rest, "/"
+	if idx := strings.IndexAny(rest, "/?"); idx != -1 {
+		authority, pathAndQuery = rest[:idx], rest[idx:]
+		if pathAndQuery[0] == '?' {
+			pathAndQuery = "/" + pathAndQuery
+		}
+	}
+	if !validAuthority(authority, false) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTarget, target)
+	}
+	u := &URL{
+		Form:   AbsoluteForm,
+		Scheme: strings.ToLower(scheme),
+		Host:   authority,
+	}
+	if err := u.setPathAndQuery(pathAndQuery); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (u *URL) setPathAndQuery(target string) error {
+	rawPath, rawQuery, _ := strings.Cut(target, "?")
+	path, err := unescape(rawPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+	if strings.IndexByte(path, 0) != -1 {
+		return fmt.Errorf("%w: NUL in path", ErrInvalidTarget)
+	}
+	if err := checkEscapes(rawQuery); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+	u.RawPath = rawPath
+	u.Path = removeDotSegments(path)
+	u.RawQuery = rawQuery
+	return nil
+}
+
+func validScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+	for i, c := range scheme {
+		isAlpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isAlpha && (i == 0 || ((c < '0' || c > '9') && c != '+' && c != '-' && c != '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+// validAuthority checks host[:port], with userinfo rejected as RFC 9112
+// forbids it in request targets.
+func validAuthority(authority string, portRequired bool) bool {
+	if authority == "" || strings.Contains(authority, "@") {
+		return false
+	}
+	host, port := authority, ""
+	if strings.HasPrefix(authority, "[") {
+		end := strings.IndexByte(authority, ']')
+		if end == -1 {
+			return false
+		}
+		host, port = authority[:end+1], authority[end+1:]
+		if port != "" && !strings.HasPrefix(port, ":") {
+			return false
+		}
+		port = strings.TrimPrefix(port, ":")
+	} else if idx := strings.LastIndexByte(authority, ':'); idx != -1 {
+		host, port = authority[:idx], authority[idx+1:]
+	} else if portRequired {
+		return false
+	}
+	if host == "" || (portRequired && port == "") {
+		return false
+	}
+	for _, c := range port {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// removeDotSegments resolves "." and ".." as in RFC 3986 section 5.2.4,
+// never climbing above the root.
+func removeDotSegments(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+	cleaned := strings.Join(out, "/")
+	if !strings.HasPrefix(cleaned, "/") {
+		cleaned = "/" + cleaned
+	}
+	return cleaned
+}
+
+func checkEscapes(s string) error {
+	_, err := unescape(s)
+	return err
+}
+
+func unescape(s string) (string, error) {
+	if strings.IndexByte(s, '%') == -1 {
+		return s, nil
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			return "", fmt.Errorf("invalid percent-encoding in %q", s)
+		}
+		b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
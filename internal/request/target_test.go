@@ -0,0 +1,88 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		expectError bool
+		form        TargetForm
+		scheme      string
+		host        string
+		path        string
+		rawQuery    string
+	}{
+		{name: "Origin form", method: "GET", target: "/coffee", form: OriginForm, path: "/coffee"},
+		{name: "Origin form with query", method: "GET", target: "/search?q=go&page=2", form: OriginForm, path: "/search", rawQuery: "q=go&page=2"},
+		{name: "Percent-decoded path", method: "GET", target: "/caf%C3%A9/a%20b", form: OriginForm, path: "/café/a b"},
+		{name: "Dot segments", method: "GET", target: "/a/b/../c/./d", form: OriginForm, path: "/a/c/d"},
+		{name: "Dot segments above root", method: "GET", target: "/../../etc/passwd", form: OriginForm, path: "/etc/passwd"},
+		{name: "Encoded dot segments", method: "GET", target: "/static/%2e%2e/secret", form: OriginForm, path: "/secret"},
+		{name: "Trailing dot segment", method: "GET", target: "/a/b/..", form: OriginForm, path: "/a/"},
+		{name: "Absolute form", method: "GET", target: "http://example.com:8080/x?y=1", form: AbsoluteForm, scheme: "http", host: "example.com:8080", path: "/x", rawQuery: "y=1"},
+		{name: "Absolute form without path", method: "GET", target: "HTTP://example.com", form: AbsoluteForm, scheme: "http", host: "example.com", path: "/"},
+		{name: "Absolute form with query only", method: "GET", target: "http://example.com?y=1", form: AbsoluteForm, scheme: "http", host: "example.com", path: "/", rawQuery: "y=1"},
+		{name: "Authority form", method: "CONNECT", target: "example.com:443", form: AuthorityForm, host: "example.com:443"},
+		{name: "Authority form IPv6", method: "CONNECT", target: "[::1]:443", form: AuthorityForm, host: "[::1]:443"},
+		{name: "Asterisk form", method: "OPTIONS", target: "*", form: AsteriskForm},
+
+		{name: "Asterisk without OPTIONS", method: "GET", target: "*", expectError: true},
+		{name: "CONNECT without port", method: "CONNECT", target: "example.com", expectError: true},
+		{name: "CONNECT with path", method: "CONNECT", target: "/tunnel", expectError: true},
+		{name: "Authority form without CONNECT", method: "GET", target: "example.com:443", expectError: true},
+		{name: "Relative path", method: "GET", target: "coffee", expectError: true},
+		{name: "Bad percent-encoding", method: "GET", target: "/a%2", expectError: true},
+		{name: "Bad percent-encoding in query", method: "GET", target: "/a?b=%zz", expectError: true},
+		{name: "Encoded NUL", method: "GET", target: "/a%00b", expectError: true},
+		{name: "Fragment", method: "GET", target: "/a#frag", expectError: true},
+		{name: "Userinfo", method: "GET", target: "http://user@example.com/", expectError: true},
+		{name: "Control character", method: "GET", target: "/a\x01b", expectError: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := parseTarget(tc.method, tc.target)
+			if tc.expectError {
+				require.ErrorIs(t, err, ErrInvalidTarget)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.form, u.Form)
+			assert.Equal(t, tc.scheme, u.Scheme)
+			assert.Equal(t, tc.host, u.Host)
+			assert.Equal(t, tc.path, u.Path)
+			assert.Equal(t, tc.rawQuery, u.RawQuery)
+		})
+	}
+}
+
+func TestURL_Query(t *testing.T) {
+	_, err := RequestFromReader(&chunkReader{
+		data:            "GET /search?q=hello+world&tag=a&tag=b%26c&empty=&flag&bad=%zz HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 4,
+	})
+	// %zz makes the whole target invalid
+	require.Error(t, err)
+
+	r, err := RequestFromReader(&chunkReader{
+		data:            "GET /search?q=hello+world&tag=a&tag=b%26c&empty=&flag HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 4,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "/search?q=hello+world&tag=a&tag=b%26c&empty=&flag", r.RequestLine.RequestTarget)
+	assert.Equal(t, "/search", r.URL.Path)
+
+	query := r.URL.Query()
+	assert.Equal(t, "hello world", query.Get("q"))
+	assert.Equal(t, []string{"a", "b&c"}, query["tag"])
+	assert.True(t, query.Has("empty"))
+	assert.Equal(t, "", query.Get("empty"))
+	assert.True(t, query.Has("flag"))
+	assert.False(t, query.Has("missing"))
+}
@@ -0,0 +1,142 @@
+package response
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// bufferedWriterSize is large enough to carry the headers and a few
+// small chunks in one write to the connection.
+const bufferedWriterSize = 8 << 10
+
+var bufioPool = sync.Pool{
+	New: func() any {
+		return bufio.NewWriterSize(nil, bufferedWriterSize)
+	},
+}
+
+// Flusher is implemented by writers that hold output back. Flushing sends
+// everything written so far on to the client.
+type Flusher interface {
+	Flush() error
+}
+
+// NewBufferedResponse is NewResponse with output collected in a pooled
+// bufio.Writer, so the status line, headers and chunk framing do not each
+// cost a write to the connection. Nothing reaches w until Flush or Release;
+// Release must be called once the response is done.
+func NewBufferedResponse(w io.Writer) Writer {
+	bw := bufioPool.Get().(*bufio.Writer)
+	writer := NewResponse(bw)
+	s := writer.WriterState
+	s.conn.w = w
+	bw.Reset(&s.conn)
+	s.bw = bw
+	return writer
+}
+
+// Discard throws the response away and starts over, so a server can send
+// an error in place of a handler that failed halfway. That is only possible
+// while none of the final response has reached the connection; interim 1xx
+// responses do not count. Otherwise, and for writers made with
+// NewResponse, it returns false and changes nothing. The HTTP version,
+// header order, buffer size and server name are kept.
+func (w *Writer) Discard() bool {
+	s := w.WriterState
+	if s.bw == nil || s.conn.sent {
+		return false
+	}
+	s.bw.Reset(&s.conn)
+	*s = WriterState{
+		httpVersion: s.httpVersion,
+		method:      s.method,
+		headerOrder: s.headerOrder,
+		serverName:  s.serverName,
+		bufferSize:  s.bufferSize,
+		bw:          s.bw,
+		conn:        s.conn,
+	}
+	w.Writer = s.bw
+	return true
+}
+
+// Flush sends what the handler has written so far to the client. If the
+// headers are still pending they go out first, with chunked encoding since
+// the length of the body is not known yet. Streaming handlers call it
+// whenever the client should see progress.
+func (w *Writer) Flush() error {
+	s := w.WriterState
+	out := w.output()
+	if !s.headersWritten && (s.statusLineWritten || s.out != nil || s.pending != nil) {
+		if err := out.commit(false); err != nil {
+			return err
+		}
+		if err := out.flushBuffered(); err != nil {
+			return err
+		}
+	}
+	return w.flushConn()
+}
+
+// flushConn pushes buffered output to the connection without touching the
+// response state.
+func (w *Writer) flushConn() error {
+	if w.WriterState.bw != nil {
+		return w.WriterState.bw.Flush()
+	}
+	if f, ok := w.Writer.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Release flushes any buffered output and returns the buffer to the pool.
+// The Writer must not be used afterwards. It does nothing for writers made
+// with NewResponse.
+func (w *Writer) Release() error {
+	bw := w.WriterState.bw
+	if bw == nil {
+		return nil
+	}
+	w.WriterState.bw = nil
+	err := bw.Flush()
+	bw.Reset(nil)
+	bufioPool.Put(bw)
+	return err
+}
+
+// connWriter passes the output of the buffer on to the connection and
+// notes whether any of the final response has gone out. Its ReadFrom keeps
+// the connection's own, and with it sendfile, within reach of
+// bufio.Writer.ReadFrom.
+type connWriter struct {
+	w    io.Writer
+	sent bool
+}
+
+func (c *connWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		c.sent = true
+	}
+	return c.w.Write(p)
+}
+
+func (c *connWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(c.w, r)
+	if n > 0 {
+		c.sent = true
+	}
+	return n, err
+}
+
+// output returns w writing through the writer the handler used for the
+// body, so bytes written on the handler's behalf pass through the same
+// wrappers.
+func (w *Writer) output() Writer {
+	out := *w
+	if w.WriterState.out != nil {
+		out.Writer = w.WriterState.out
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCounter counts the writes that reach it, standing in for syscalls.
+type writeCounter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Buffer.Write(p)
+}
+
+func TestBufferedResponse_CoalescesWrites(t *testing.T) {
+	var conn writeCounter
+	w := NewBufferedResponse(&conn)
+	require.NoError(t, w.WriteStatusLine(Success))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	chunk := bytes.Repeat([]byte("x"), 1024)
+	for i := 0; i < 4; i++ {
+		_, err := w.WriteChunkedBody(chunk)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Finish())
+	assert.Equal(t, 0, conn.writes, "nothing should reach the connection before a flush")
+
+	require.NoError(t, w.Release())
+	assert.Equal(t, 1, conn.writes)
+	assert.True(t, strings.HasSuffix(conn.String(), "400\r\n"+string(chunk)+"\r\n0\r\n\r\n"))
+	require.NoError(t, w.Release())
+}
+
+func TestBufferedResponse_Flush(t *testing.T) {
+	var conn writeCounter
+	w := NewBufferedResponse(&conn)
+	defer w.Release()
+	w.Header().Set("Content-Type", "text/event-stream")
+	io.WriteString(w, "data: 1\n\n")
+	assert.Empty(t, conn.String())
+
+	// Test: Flushing before the headers commits to chunked encoding
+	require.NoError(t, w.Flush())
+	assert.True(t, w.HeadersWritten())
+	assert.Contains(t, conn.String(), "Transfer-Encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(conn.String(), "9\r\ndata: 1\n\n\r\n"), conn.String())
+
+	io.WriteString(w, "data: 2\n\n")
+	before := conn.Len()
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "9\r\ndata: 2\n\n\r\n", conn.String()[before:])
+}
+
+func TestBufferedResponse_InformationalFlushed(t *testing.T) {
+	var conn writeCounter
+	w := NewBufferedResponse(&conn)
+	defer w.Release()
+	w.ExpectContinue()
+	require.NoError(t, w.WriteContinue())
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n", conn.String())
+}
+
+func TestBufferedResponse_Discard(t *testing.T) {
+	var conn writeCounter
+	w := NewBufferedResponse(&conn)
+	defer w.Release()
+	w.SetHTTPVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(Success))
+	io.WriteString(w, "partial")
+
+	// Test: Nothing sent yet, so the response starts over
+	require.True(t, w.Discard())
+	assert.False(t, w.StatusLineWritten())
+	require.NoError(t, w.WriteStatusLine(InternalServerError))
+	require.NoError(t, w.Finish())
+	require.NoError(t, w.Flush())
+	assert.True(t, strings.HasPrefix(conn.String(), "HTTP/1.0 500 Internal Server Error\r\n"), conn.String())
+	assert.NotContains(t, conn.String(), "partial")
+
+	// Test: Once bytes are out there is no going back
+	assert.False(t, w.Discard())
+	assert.True(t, w.HeadersWritten())
+
+	// Test: Interim responses leave the final one open to replacement
+	conn.Reset()
+	w2 := NewBufferedResponse(&conn)
+	defer w2.Release()
+	w2.ExpectContinue()
+	require.NoError(t, w2.WriteContinue())
+	require.NoError(t, w2.WriteStatusLine(Success))
+	assert.True(t, w2.Discard())
+
+	// Test: Unbuffered writers cannot take anything back
+	plain := NewResponse(&bytes.Buffer{})
+	assert.False(t, plain.Discard())
+}
+
+func TestWriter_FlushUsesFlusher(t *testing.T) {
+	var conn writeCounter
+	bw := NewBufferedResponse(&conn)
+	defer bw.Release()
+
+	// A Writer over something that buffers on its own flushes it too.
+	w := NewResponse(bw.WriterState.bw)
+	require.NoError(t, w.WriteStatusLine(Success))
+	require.NoError(t, w.Flush())
+	assert.True(t, strings.HasPrefix(conn.String(), "HTTP/1.1 200 OK\r\n"))
+}
+
+// BenchmarkChunkedStream streams 1 MiB in the 1 KiB chunks the video
+// endpoint uses over a loopback TCP connection.
+func BenchmarkChunkedStream(b *testing.B) {
+	for _, bc := range []struct {
+		name      string
+		newWriter func(io.Writer) Writer
+	}{
+		{"unbuffered", NewResponse},
+		{"buffered", NewBufferedResponse},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			client, server := tcpPair(b)
+			go io.Copy(io.Discard, client)
+
+			const total = 1 << 20
+			chunk := make([]byte, 1024)
+			h := headers.NewHeaders()
+			h.Set("Transfer-Encoding", "chunked")
+			b.SetBytes(total)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := bc.newWriter(server)
+				w.WriteStatusLine(Success)
+				w.WriteHeaders(h.Clone())
+				for sent := 0; sent < total; sent += len(chunk) {
+					if _, err := w.WriteChunkedBody(chunk); err != nil {
+						b.Fatal(err)
+					}
+				}
+				w.Finish()
+				w.Release()
+			}
+		})
+	}
+}
+
+func tcpPair(b testing.TB) (net.Conn, net.Conn) {
+	b.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(b, err)
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(b, err)
+	server := <-accepted
+	require.NotNil(b, server)
+	b.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
@@ -0,0 +1,247 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+)
+
+// chunkState orders the parts of a chunked body: any number of chunks, the
+// last chunk, then the trailer section (RFC 9112 section 7.1).
+type chunkState int
+
+const (
+	chunkNone chunkState = iota // the response is not chunked
+	chunkData                   // chunks may be written
+	chunkLast                   // the last chunk is out, trailers are next
+	chunkDone                   // the trailer section ended the body
+)
+
+var (
+	ErrNotChunked          = errors.New("response is not chunked")
+	ErrChunkedBodyEnded    = errors.New("chunked body already ended")
+	ErrLastChunkNotWritten = errors.New("trailers before the last chunk")
+	ErrTrailerNotDeclared  = errors.New("trailer field not declared in Trailer")
+	ErrTrailerForbidden    = errors.New("field not allowed in trailers")
+	ErrInvalidExtension    = errors.New("invalid chunk extension")
+)
+
+// forbiddenTrailers are the fields a recipient needs before it can handle
+// the body, or that control routing, authentication or caching, and so must
+// never arrive after it (RFC 9110 section 6.5.1).
+var forbiddenTrailers = map[string]bool{
+	"age":                 true,
+	"authorization":       true,
+	"cache-control":       true,
+	"content-encoding":    true,
+	"content-length":      true,
+	"content-range":       true,
+	"content-type":        true,
+	"date":                true,
+	"expect":              true,
+	"expires":             true,
+	"host":                true,
+	"if-match":            true,
+	"if-modified-since":   true,
+	"if-none-match":       true,
+	"if-range":            true,
+	"if-unmodified-since": true,
+	"location":            true,
+	"max-forwards":        true,
+	"pragma":              true,
+	"proxy-authenticate":  true,
+	"proxy-authorization": true,
+	"range":               true,
+	"retry-after":         true,
+	"set-cookie":          true,
+	"te":                  true,
+	"trailer":             true,
+	"transfer-encoding":   true,
+	"vary":                true,
+	"www-authenticate":    true,
+}
+
+// ChunkExtension is a name=value pair sent after a chunk's size. An empty
+// Value sends the name alone.
+type ChunkExtension struct {
+	Name  string
+	Value string
+}
+
+// WriteChunkedBody writes p as one chunk, with any extensions after its
+// size. It fails once the last chunk has been written. Writing an empty p
+// does nothing, since an empty chunk would end the body; use
+// WriteChunkedBodyEnd for that.
+func (w *Writer) WriteChunkedBody(p []byte, ext ...ChunkExtension) (int, error) {
+	if err := w.checkChunkState(chunkData); err != nil {
+		return 0, err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.isHEAD() {
+		return len(p), nil
+	}
+	if w.WriterState.unchunked {
+		return w.Writer.Write(p)
+	}
+	extensions, err := formatExtensions(ext)
+	if err != nil {
+		return 0, err
+	}
+	var sizeBuf [32]byte
+	size := strconv.AppendInt(sizeBuf[:0], int64(len(p)), 16)
+	size = append(size, extensions...)
+	size = append(size, crlf...)
+	if _, ok := w.Writer.(net.Conn); ok {
+		// A bare connection gets the size line, data and CRLF in a
+		// single writev instead of three writes.
+		chunk := net.Buffers{size, p, crlf}
+		written, err := chunk.WriteTo(w.Writer)
+		n := int(min(max(written-int64(len(size)), 0), int64(len(p))))
+		return n, err
+	}
+	if _, err := w.Writer.Write(size); err != nil {
+		return 0, err
+	}
+	n, err := w.Writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if _, err := w.Writer.Write(crlf); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+var crlf = []byte("\r\n")
+
+// WriteChunkedBodyEnd writes the last chunk. WriteTrailers has to follow,
+// even without trailers, to end the body; Finish does that for handlers
+// that stop here.
+func (w *Writer) WriteChunkedBodyEnd(ext ...ChunkExtension) error {
+	if err := w.checkChunkState(chunkData); err != nil {
+		return err
+	}
+	extensions, err := formatExtensions(ext)
+	if err != nil {
+		return err
+	}
+	if !w.WriterState.unchunked && !w.isHEAD() {
+		if _, err := fmt.Fprintf(w.Writer, "0%s\r\n", extensions); err != nil {
+			return err
+		}
+	}
+	w.WriterState.chunkState = chunkLast
+	return nil
+}
+
+// WriteTrailers writes the trailer section that ends a chunked body. It
+// must follow WriteChunkedBodyEnd, and every field has to be one the
+// headers announced in Trailer and one that is allowed after the body;
+// otherwise nothing is written and the error is a *headers.FieldError.
+func (w *Writer) WriteTrailers(trailers headers.Headers) error {
+	if err := w.checkChunkState(chunkLast); err != nil {
+		return err
+	}
+	if err := w.checkTrailers(trailers); err != nil {
+		return err
+	}
+	// There is nowhere to put trailers in a close-delimited body, nor
+	// after the body a HEAD response leaves out.
+	if !w.WriterState.unchunked && !w.isHEAD() {
+		if err := writeFieldSection(w.Writer, trailers, w.WriterState.headerOrder); err != nil {
+			return err
+		}
+	}
+	w.WriterState.chunkState = chunkDone
+	return nil
+}
+
+func (w *Writer) checkChunkState(want chunkState) error {
+	if !w.WriterState.statusLineWritten {
+		return fmt.Errorf("Status line not written")
+	}
+	if !w.WriterState.headersWritten {
+		return fmt.Errorf("Headers not written")
+	}
+	switch w.WriterState.chunkState {
+	case want:
+		return nil
+	case chunkNone:
+		return ErrNotChunked
+	case chunkData:
+		return ErrLastChunkNotWritten
+	default:
+		return ErrChunkedBodyEnded
+	}
+}
+
+func (w *Writer) checkTrailers(trailers headers.Headers) error {
+	declared := make(map[string]bool)
+	for _, name := range w.WriterState.declaredTrailers {
+		declared[strings.ToLower(name)] = true
+	}
+	var err error
+	trailers.Range(func(name string, _ []string) bool {
+		canonical := strings.ToLower(name)
+		switch {
+		case forbiddenTrailers[canonical]:
+			err = &headers.FieldError{Name: name, Err: ErrTrailerForbidden}
+		case !declared[canonical]:
+			err = &headers.FieldError{Name: name, Err: ErrTrailerNotDeclared}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// formatExtensions renders ext as it follows a chunk size, quoting values
+// that are not tokens.
+func formatExtensions(ext []ChunkExtension) (string, error) {
+	var b strings.Builder
+	for _, e := range ext {
+		if !headers.ValidName(e.Name) {
+			return "", fmt.Errorf("%w: name %q", ErrInvalidExtension, e.Name)
+		}
+		b.WriteByte(';')
+		b.WriteString(e.Name)
+		if e.Value == "" {
+			continue
+		}
+		b.WriteByte('=')
+		if headers.ValidName(e.Value) {
+			b.WriteString(e.Value)
+			continue
+		}
+		quoted, ok := quoteString(e.Value)
+		if !ok {
+			return "", fmt.Errorf("%w: value %q", ErrInvalidExtension, e.Value)
+		}
+		b.WriteString(quoted)
+	}
+	return b.String(), nil
+}
+
+// quoteString returns s as a quoted-string, or false if s holds control
+// characters that cannot be sent even quoted.
+func quoteString(s string) (string, bool) {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+		case c != '\t' && (c < ' ' || c == 0x7f):
+			return "", false
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String(), true
+}
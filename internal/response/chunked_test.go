@@ -0,0 +1,144 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chunkedWriter(t *testing.T, buf *bytes.Buffer, trailer string) Writer {
+	t.Helper()
+	w := NewResponse(buf)
+	require.NoError(t, w.WriteStatusLine(Success))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	if trailer != "" {
+		h.Set("Trailer", trailer)
+	}
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+	return w
+}
+
+func TestWriter_ChunkedOrdering(t *testing.T) {
+	var buf bytes.Buffer
+	w := chunkedWriter(t, &buf, "X-Checksum")
+
+	// Test: Trailers before the last chunk
+	assert.ErrorIs(t, w.WriteTrailers(nil), ErrLastChunkNotWritten)
+
+	_, err := w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	n, err := w.WriteChunkedBody(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	require.NoError(t, w.WriteChunkedBodyEnd())
+
+	// Test: Chunks and a second last chunk after the end
+	_, err = w.WriteChunkedBody([]byte("late"))
+	assert.ErrorIs(t, err, ErrChunkedBodyEnded)
+	assert.ErrorIs(t, w.WriteChunkedBodyEnd(), ErrChunkedBodyEnded)
+	_, err = w.Write([]byte("late"))
+	assert.ErrorIs(t, err, ErrChunkedBodyEnded)
+
+	trailers := headers.NewHeaders()
+	trailers.Set("x-checksum", "123")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.ErrorIs(t, w.WriteTrailers(nil), ErrChunkedBodyEnded)
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "3\r\nabc\r\n0\r\nx-checksum: 123\r\n\r\n", buf.String())
+}
+
+func TestWriter_ChunkedRequiresChunkedResponse(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	require.NoError(t, w.WriteStatusLine(Success))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(3)))
+
+	_, err := w.WriteChunkedBody([]byte("abc"))
+	assert.ErrorIs(t, err, ErrNotChunked)
+	assert.ErrorIs(t, w.WriteChunkedBodyEnd(), ErrNotChunked)
+	assert.ErrorIs(t, w.WriteTrailers(nil), ErrNotChunked)
+}
+
+func TestWriter_TrailerValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		declare string
+		field   string
+		want    error
+	}{
+		{"undeclared", "X-Checksum", "X-Other", ErrTrailerNotDeclared},
+		{"nothing declared", "", "X-Checksum", ErrTrailerNotDeclared},
+		{"content-length", "Content-Length", "Content-Length", ErrTrailerForbidden},
+		{"host", "Host", "host", ErrTrailerForbidden},
+		{"transfer-encoding", "Transfer-Encoding", "Transfer-Encoding", ErrTrailerForbidden},
+		{"authorization", "Authorization", "Authorization", ErrTrailerForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := chunkedWriter(t, &buf, tc.declare)
+			require.NoError(t, w.WriteChunkedBodyEnd())
+			buf.Reset()
+
+			trailers := headers.NewHeaders()
+			trailers.Set(tc.field, "1")
+			err := w.WriteTrailers(trailers)
+			assert.ErrorIs(t, err, tc.want)
+			var fieldErr *headers.FieldError
+			require.ErrorAs(t, err, &fieldErr)
+			assert.Equal(t, tc.field, fieldErr.Name)
+			assert.Empty(t, buf.String())
+
+			// The body can still be ended properly.
+			require.NoError(t, w.WriteTrailers(nil))
+			assert.Equal(t, "\r\n", buf.String())
+		})
+	}
+}
+
+func TestWriter_ChunkExtensions(t *testing.T) {
+	var buf bytes.Buffer
+	w := chunkedWriter(t, &buf, "")
+	_, err := w.WriteChunkedBody([]byte("abc"), ChunkExtension{Name: "sig", Value: "xyz"}, ChunkExtension{Name: "final"})
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("d"), ChunkExtension{Name: "note", Value: `say "hi"`})
+	require.NoError(t, err)
+
+	// Test: Invalid extensions write nothing
+	for _, ext := range []ChunkExtension{{Name: "bad name"}, {Name: "", Value: "x"}, {Name: "x", Value: "a\r\nb"}} {
+		_, err = w.WriteChunkedBody([]byte("e"), ext)
+		assert.ErrorIs(t, err, ErrInvalidExtension, "%+v", ext)
+	}
+
+	require.NoError(t, w.WriteChunkedBodyEnd(ChunkExtension{Name: "done"}))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "3;sig=xyz;final\r\nabc\r\n1;note=\"say \\\"hi\\\"\"\r\nd\r\n0;done\r\n\r\n", buf.String())
+}
+
+func TestWriter_ChunkedHTTP10(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.SetHTTPVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(Success))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Sum")
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+
+	_, err := w.WriteChunkedBody([]byte("abc"), ChunkExtension{Name: "x"})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteChunkedBodyEnd())
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Other", "1")
+	assert.ErrorIs(t, w.WriteTrailers(trailers), ErrTrailerNotDeclared)
+	trailers = headers.NewHeaders()
+	trailers.Set("X-Sum", "1")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "abc", buf.String())
+}
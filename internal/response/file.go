@@ -0,0 +1,110 @@
+package response
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+)
+
+var ErrIsDirectory = errors.New("cannot serve a directory")
+
+// ReadFrom copies r into the body, which makes io.Copy into a Writer use
+// it. When r is a regular *os.File, or an io.LimitedReader around one, and
+// the headers are still pending, its remaining length goes out as
+// Content-Length and the file is handed to the connection in one go: on
+// Linux a *net.TCPConn sends it with sendfile, without copying it through
+// userspace. Other readers, and responses that are already chunked, are
+// copied through Write.
+//
+// Like Write, ReadFrom has a value receiver so a handler's Writer is an
+// io.ReaderFrom.
+func (w Writer) ReadFrom(r io.Reader) (int64, error) {
+	s := w.WriterState
+	size, sized := remaining(r)
+	if !s.headersWritten {
+		if !sized {
+			return io.Copy(writerOnly{w}, r)
+		}
+		if s.out == nil {
+			s.out = w.Writer
+		}
+		if s.statusCode == 0 {
+			s.statusCode = Success
+		}
+		h := w.Header()
+		if bodyAllowed(s.statusCode) && !h.Has("Content-Length") && !h.Has("Transfer-Encoding") {
+			h.Set("Content-Length", strconv.FormatInt(int64(len(s.buf))+size, 10))
+		}
+		if err := w.commit(false); err != nil {
+			return 0, err
+		}
+		if err := w.flushBuffered(); err != nil {
+			return 0, err
+		}
+	}
+	if w.isHEAD() {
+		// The length is all a HEAD response needs; the file stays unread.
+		return 0, nil
+	}
+	if s.chunkState != chunkNone && !s.unchunked {
+		return io.Copy(writerOnly{w}, r)
+	}
+	if sized {
+		// Never send more than was announced, even if the file grows. The
+		// connection only finds the file under a single LimitedReader.
+		if lr, ok := r.(*io.LimitedReader); ok {
+			r = lr.R
+		}
+		r = io.LimitReader(r, size)
+	}
+	// Everything buffered has to go out first. An empty bufio.Writer then
+	// hands the reader straight to the connection's ReadFrom.
+	if err := w.flushConn(); err != nil {
+		return 0, err
+	}
+	return io.Copy(w.Writer, r)
+}
+
+// ServeFile sends f from its current offset to the end as the body, with
+// a Content-Length, using sendfile where the connection supports it. A 200
+// status is written if the handler has not written one.
+func (w *Writer) ServeFile(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return ErrIsDirectory
+	}
+	_, err = w.ReadFrom(f)
+	return err
+}
+
+// remaining reports how many bytes are left in r when that is known up
+// front, which it is for regular files and for limited reads from them.
+func remaining(r io.Reader) (int64, bool) {
+	if lr, ok := r.(*io.LimitedReader); ok {
+		size, sized := remaining(lr.R)
+		return min(size, max(lr.N, 0)), sized
+	}
+	f, ok := r.(*os.File)
+	if !ok {
+		return 0, false
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	return max(info.Size()-offset, 0), true
+}
+
+// writerOnly hides ReadFrom, so io.Copy goes through Write instead of
+// calling back into Writer.ReadFrom.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,156 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempFile(t *testing.T, content string) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "body.bin")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestWriter_ServeFileOverTCP(t *testing.T) {
+	content := strings.Repeat("0123456789", 10000)
+	for _, bc := range []struct {
+		name      string
+		newWriter func(io.Writer) Writer
+	}{
+		{"unbuffered", NewResponse},
+		{"buffered", NewBufferedResponse},
+	} {
+		t.Run(bc.name, func(t *testing.T) {
+			client, server := tcpPair(t)
+			f := tempFile(t, content)
+			_, err := f.Seek(10, io.SeekStart)
+			require.NoError(t, err)
+
+			go func() {
+				w := bc.newWriter(server)
+				w.Header().Set("Content-Type", "application/octet-stream")
+				assert.NoError(t, w.ServeFile(f))
+				assert.NoError(t, w.Finish())
+				assert.NoError(t, w.Release())
+			}()
+
+			r := bufio.NewReader(client)
+			statusLine, err := r.ReadString('\n')
+			require.NoError(t, err)
+			assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+			var lines []string
+			for {
+				line, err := r.ReadString('\n')
+				require.NoError(t, err)
+				if line == "\r\n" {
+					break
+				}
+				lines = append(lines, line)
+			}
+			assert.Contains(t, lines, "Content-Length: 99990\r\n")
+			body := make([]byte, len(content)-10)
+			_, err = io.ReadFull(r, body)
+			require.NoError(t, err)
+			assert.Equal(t, content[10:], string(body))
+		})
+	}
+}
+
+func TestWriter_ReadFromBufferedPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.Write([]byte("head:"))
+	n, err := io.Copy(w, tempFile(t, "file body"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), n)
+	require.NoError(t, w.Finish())
+
+	lines, body := splitResponse(t, buf.String())
+	assert.Contains(t, lines, "Content-Length: 14")
+	assert.Equal(t, "head:file body", body)
+}
+
+func TestWriter_ReadFromLimitedFile(t *testing.T) {
+	for _, bc := range []struct {
+		name  string
+		limit int64
+		want  string
+	}{
+		{"within the file", 3, "cde"},
+		{"past the end", 100, "cdefgh"},
+	} {
+		t.Run(bc.name, func(t *testing.T) {
+			f := tempFile(t, "abcdefgh")
+			_, err := f.Seek(2, io.SeekStart)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			w := NewResponse(&buf)
+			_, err = io.Copy(w, io.LimitReader(f, bc.limit))
+			require.NoError(t, err)
+			require.NoError(t, w.Finish())
+
+			lines, body := splitResponse(t, buf.String())
+			assert.Contains(t, lines, fmt.Sprintf("Content-Length: %d", len(bc.want)))
+			assert.Equal(t, bc.want, body)
+		})
+	}
+}
+
+func TestWriter_ServeFileHEAD(t *testing.T) {
+	f := tempFile(t, "hello, world")
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.SetMethod("HEAD")
+	require.NoError(t, w.ServeFile(f))
+	require.NoError(t, w.Finish())
+	lines, body := splitResponse(t, buf.String())
+	assert.Contains(t, lines, "Content-Length: 12")
+	assert.Empty(t, body)
+}
+
+func TestWriter_ReadFromFallbacks(t *testing.T) {
+	// Test: A reader of unknown length goes through automatic framing
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.SetBufferSize(4)
+	_, err := io.Copy(w, strings.NewReader("streamed"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	lines, body := splitResponse(t, buf.String())
+	assert.Contains(t, lines, "Transfer-Encoding: chunked")
+	assert.True(t, strings.HasSuffix(body, "0\r\n\r\n"))
+
+	// Test: A file into a chunked response is chunked
+	buf.Reset()
+	w = NewResponse(&buf)
+	require.NoError(t, w.WriteStatusLine(Success))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.ServeFile(tempFile(t, "abc")))
+	require.NoError(t, w.Finish())
+	_, body = splitResponse(t, buf.String())
+	assert.Equal(t, "3\r\nabc\r\n0\r\n\r\n", body)
+
+	// Test: Directories are refused
+	dir, err := os.Open(t.TempDir())
+	require.NoError(t, err)
+	defer dir.Close()
+	w = NewResponse(&bytes.Buffer{})
+	assert.ErrorIs(t, w.ServeFile(dir), ErrIsDirectory)
+}
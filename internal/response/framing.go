@@ -0,0 +1,192 @@
+package response
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+)
+
+// DefaultBufferSize is how much of the body Write holds back before it
+// gives up on Content-Length and switches to chunked encoding.
+const DefaultBufferSize = 4096
+
+// Header returns the headers to send with the response. Fields set here
+// are written by the first WriteHeaders call, or, for handlers that only
+// call Write, along with the framing Write picks. Headers reports what was
+// actually written.
+func (w *Writer) Header() headers.Headers {
+	if w.WriterState.pending == nil {
+		w.WriterState.pending = headers.NewHeaders()
+	}
+	return w.WriterState.pending
+}
+
+// SetBufferSize sets how many body bytes Write buffers before it switches
+// to chunked encoding. Zero means DefaultBufferSize.
+func (w *Writer) SetBufferSize(n int) {
+	w.WriterState.bufferSize = n
+}
+
+// SetServerName sets the Server header added to every response that does
+// not set its own. An empty name leaves it out.
+func (w *Writer) SetServerName(name string) {
+	w.WriterState.serverName = name
+}
+
+// Write makes Writer an io.Writer that frames the body itself. Until the
+// headers are written the body is buffered: if the handler returns before
+// the buffer fills, Finish sends it with a Content-Length, otherwise the
+// headers go out with chunked encoding and the body streams. Once the
+// headers are written, by Write or by WriteHeaders, Write chunks the body
+// if the response is chunked and passes it through if not.
+//
+// For HEAD, Write only counts the body, however long it gets, so Finish
+// can still send the Content-Length a GET would have had.
+//
+// Write has a value receiver, unlike the other methods, so the Writer a
+// handler receives can be passed to anything taking an io.Writer.
+func (w Writer) Write(p []byte) (int, error) {
+	s := w.WriterState
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if s.headersWritten {
+		return w.writeBody(p)
+	}
+	if s.out == nil {
+		s.out = w.Writer
+	}
+	if s.statusCode == 0 {
+		s.statusCode = Success
+	}
+	if w.isHEAD() {
+		s.headLength += len(p)
+		return len(p), nil
+	}
+	if len(s.buf)+len(p) <= w.maxBuffered() {
+		s.buf = append(s.buf, p...)
+		return len(p), nil
+	}
+	if err := w.commit(false); err != nil {
+		return 0, err
+	}
+	if err := w.flushBuffered(); err != nil {
+		return 0, err
+	}
+	return w.writeBody(p)
+}
+
+// Finish completes the response after the handler has returned: buffered
+// headers and body are written and a chunked body is terminated if the
+// handler did not do so itself. It is safe to call more than once. A
+// handler that wrote nothing at all has sent an empty body, so it gets a
+// 200 with Content-Length: 0.
+func (w *Writer) Finish() error {
+	s := w.WriterState
+	out := w.output()
+	if !s.headersWritten {
+		if err := out.commit(true); err != nil {
+			return err
+		}
+		if err := out.flushBuffered(); err != nil {
+			return err
+		}
+	}
+	if s.chunkState == chunkData {
+		if err := out.WriteChunkedBodyEnd(); err != nil {
+			return err
+		}
+	}
+	if s.chunkState == chunkLast {
+		return out.WriteTrailers(nil)
+	}
+	return nil
+}
+
+// commit writes the status line, if the handler did not, and the pending
+// headers with the framing fields filled in. final means the whole body is
+// in the buffer, so its length is known.
+func (w *Writer) commit(final bool) error {
+	s := w.WriterState
+	if !s.statusLineWritten {
+		code := s.statusCode
+		if code == 0 {
+			code = Success
+		}
+		if err := w.WriteStatusLine(code); err != nil {
+			return err
+		}
+	}
+	h := w.Header()
+	if bodyAllowed(s.statusCode) && !h.Has("Content-Length") && !h.Has("Transfer-Encoding") {
+		if final {
+			h.Set("Content-Length", strconv.Itoa(len(s.buf)+s.headLength))
+		} else {
+			h.Set("Transfer-Encoding", "chunked")
+		}
+	}
+	return w.writeHeaders(h)
+}
+
+func (w *Writer) flushBuffered() error {
+	buf := w.WriterState.buf
+	w.WriterState.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.writeBody(buf)
+	return err
+}
+
+func (w *Writer) writeBody(p []byte) (int, error) {
+	if w.isHEAD() {
+		return len(p), nil
+	}
+	if w.WriterState.chunkState != chunkNone {
+		return w.WriteChunkedBody(p)
+	}
+	return w.Writer.Write(p)
+}
+
+func (w *Writer) maxBuffered() int {
+	if w.WriterState.bufferSize > 0 {
+		return w.WriterState.bufferSize
+	}
+	return DefaultBufferSize
+}
+
+// mergePending adds the fields set through Header that h does not set
+// itself.
+func (w *Writer) mergePending(h headers.Headers) {
+	pending := w.WriterState.pending
+	if pending == nil {
+		return
+	}
+	pending.Range(func(name string, values []string) bool {
+		if h.Has(name) {
+			return true
+		}
+		for _, value := range values {
+			h.Add(name, value)
+		}
+		return true
+	})
+}
+
+// addDefaultHeaders adds Date, which origin servers with a clock must send,
+// and Server, unless the handler set its own.
+func (w *Writer) addDefaultHeaders(h headers.Headers) {
+	if !h.Has("Date") {
+		h.Set("Date", headers.FormatTime(time.Now()))
+	}
+	if w.WriterState.serverName != "" && !h.Has("Server") {
+		h.Set("Server", w.WriterState.serverName)
+	}
+}
+
+// bodyAllowed reports whether a response with this status can carry a
+// body at all; 1xx, 204 and 304 responses end with their headers.
+func bodyAllowed(code StatusCode) bool {
+	return code >= 200 && code != NoContent && code != NotModified
+}
@@ -0,0 +1,189 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// splitResponse returns the header lines of raw, without the status line,
+// and the body.
+func splitResponse(t *testing.T, raw string) ([]string, string) {
+	t.Helper()
+	head, body, ok := strings.Cut(raw, "\r\n\r\n")
+	require.True(t, ok, raw)
+	lines := strings.Split(head, "\r\n")
+	return lines[1:], body
+}
+
+func TestWriter_WriteSmallBody(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.SetServerName("httptcp")
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, "<p>")
+	fmt.Fprint(w, "hi</p>")
+	assert.Empty(t, buf.String(), "body should be buffered")
+	assert.Equal(t, Success, w.StatusCode())
+
+	require.NoError(t, w.Finish())
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	lines, body := splitResponse(t, buf.String())
+	assert.Equal(t, "Content-Type: text/html", lines[0])
+	assert.Equal(t, "Content-Length: 9", lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "Date: "), lines[2])
+	assert.Equal(t, "Server: httptcp", lines[3])
+	assert.Equal(t, "<p>hi</p>", body)
+	assert.False(t, w.ShouldClose())
+}
+
+func TestWriter_WriteLargeBody(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.SetBufferSize(8)
+	require.NoError(t, w.WriteStatusLine(NotFound))
+	w.Write([]byte("1234"))
+	w.Write([]byte("56789"))
+	assert.True(t, w.HeadersWritten())
+	w.Write([]byte("ab"))
+	require.NoError(t, w.Finish())
+
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 404 Not Found\r\n"))
+	lines, body := splitResponse(t, buf.String())
+	assert.Contains(t, lines, "Transfer-Encoding: chunked")
+	assert.Equal(t, "4\r\n1234\r\n5\r\n56789\r\n2\r\nab\r\n0\r\n\r\n", body)
+	assert.False(t, w.ShouldClose())
+}
+
+func TestWriter_WriteLargeBodyHTTP10(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.SetHTTPVersion("1.0")
+	w.SetBufferSize(4)
+	w.Write([]byte("123456"))
+	require.NoError(t, w.Finish())
+
+	lines, body := splitResponse(t, buf.String())
+	assert.NotContains(t, lines, "Transfer-Encoding: chunked")
+	assert.Contains(t, lines, "Connection: close")
+	assert.Equal(t, "123456", body)
+	assert.True(t, w.ShouldClose())
+}
+
+func TestWriter_HEAD(t *testing.T) {
+	// Test: The length is counted past the buffer, the body is left out
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.SetMethod("HEAD")
+	w.SetBufferSize(8)
+	w.Write([]byte("1234"))
+	w.Write([]byte("56789"))
+	assert.False(t, w.HeadersWritten())
+	require.NoError(t, w.Finish())
+	lines, body := splitResponse(t, buf.String())
+	assert.Contains(t, lines, "Content-Length: 9")
+	assert.Empty(t, body)
+	assert.False(t, w.ShouldClose())
+
+	// Test: A chunked body is left out, last chunk and trailers included
+	buf.Reset()
+	w = NewResponse(&buf)
+	w.SetMethod("HEAD")
+	require.NoError(t, w.WriteStatusLine(Success))
+	h := GetDefaultHeaders(0)
+	h.Del("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	n, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	require.NoError(t, w.Finish())
+	lines, body = splitResponse(t, buf.String())
+	assert.Contains(t, lines, "Transfer-Encoding: chunked")
+	assert.Empty(t, body)
+}
+
+func TestWriter_HeaderMergedIntoWriteHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.Header().Set("X-Request-Id", "42")
+	w.Header().Set("Content-Type", "text/html")
+	require.NoError(t, w.WriteStatusLine(Success))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	w.Write([]byte("ok"))
+	require.NoError(t, w.Finish())
+
+	lines, body := splitResponse(t, buf.String())
+	assert.Contains(t, lines, "X-Request-Id: 42")
+	assert.Contains(t, lines, "Content-Type: text/plain")
+	assert.NotContains(t, lines, "Content-Type: text/html")
+	assert.Equal(t, "ok", body)
+}
+
+func TestWriter_FinishEndsManualChunkedBody(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	require.NoError(t, w.WriteStatusLine(Success))
+	w.Header().Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(w.Header()))
+	w.Write([]byte("abc"))
+	require.NoError(t, w.Finish())
+
+	_, body := splitResponse(t, buf.String())
+	assert.Equal(t, "3\r\nabc\r\n0\r\n\r\n", body)
+}
+
+func TestWriter_FinishWithoutBody(t *testing.T) {
+	// Test: Nothing written is an empty 200
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.HeadersWritten())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"), buf.String())
+	lines, body := splitResponse(t, buf.String())
+	assert.Contains(t, lines, "Content-Length: 0")
+	assert.Empty(t, body)
+	assert.False(t, w.ShouldClose())
+
+	// Test: Status only gets an empty framed body
+	buf.Reset()
+	w = NewResponse(&buf)
+	require.NoError(t, w.WriteStatusLine(Created))
+	require.NoError(t, w.Finish())
+	lines, body = splitResponse(t, buf.String())
+	assert.Contains(t, lines, "Content-Length: 0")
+	assert.Empty(t, body)
+
+	// Test: 204 carries no framing at all
+	buf.Reset()
+	w = NewResponse(&buf)
+	require.NoError(t, w.WriteStatusLine(NoContent))
+	require.NoError(t, w.Finish())
+	lines, _ = splitResponse(t, buf.String())
+	for _, line := range lines {
+		assert.False(t, strings.HasPrefix(line, "Content-Length"), line)
+	}
+	assert.False(t, w.ShouldClose())
+}
+
+func TestWriter_DefaultHeadersCanBeOverridden(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	w.SetServerName("httptcp")
+	w.Header().Set("Server", "custom")
+	w.Header().Set("Date", "Sun, 06 Nov 1994 08:49:37 GMT")
+	w.Write([]byte("x"))
+	require.NoError(t, w.Finish())
+
+	lines, _ := splitResponse(t, buf.String())
+	assert.Equal(t, []string{
+		"Server: custom",
+		"Date: Sun, 06 Nov 1994 08:49:37 GMT",
+		"Content-Length: 1",
+	}, lines)
+}
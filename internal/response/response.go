@@ -1,27 +1,81 @@
 package response
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 
 	"github.com/GhostVox/httptcp/internal/headers"
 )
 
+// Writer is handed to handlers by value, so the state lives behind a pointer
+// and is shared with the server that owns the connection.
 type Writer struct {
 	Writer      io.Writer
-	WriterState WriterState
+	WriterState *WriterState
 }
 
 type WriterState struct {
 	statusLineWritten bool
 	headersWritten    bool
 	bodyWritten       bool
+	closeConn         bool
+	httpVersion       string
+	// method is the method of the request being answered. The response
+	// to HEAD is framed as if it had a body, but never sends one.
+	method string
+	// unchunked is set when a chunked response is downgraded for an
+	// HTTP/1.0 client: chunk framing is dropped and the body runs until
+	// the connection closes.
+	unchunked bool
+	// continuePending is set while a client that sent
+	// "Expect: 100-continue" is still waiting to be told to send its body.
+	continuePending bool
+	statusCode      StatusCode
+	headers         headers.Headers
+	headerOrder     HeaderOrder
+	serverName      string
+
+	// chunkState follows a chunked body from its first chunk to the
+	// trailer section. Bodies downgraded for HTTP/1.0 go through the same
+	// states, so misuse fails the same way for every client.
+	chunkState chunkState
+	// declaredTrailers is what the Trailer header announced, kept apart
+	// since the header itself is dropped for HTTP/1.0 clients.
+	declaredTrailers []string
+
+	// pending holds the headers of an automatically framed response until
+	// they are written, buf the start of its body.
+	pending    headers.Headers
+	buf        []byte
+	bufferSize int
+	// headLength counts the body a HEAD handler wrote in place of buf.
+	headLength int
+	// out is the writer the handler wrote the body through. Finish flushes
+	// through it too, so wrappers such as a middleware recorder see every
+	// byte of the body.
+	out io.Writer
+	// bw is the pooled buffer behind a Writer from NewBufferedResponse,
+	// conn what it flushes into.
+	bw   *bufio.Writer
+	conn connWriter
 }
 
+// HeaderOrder controls the order fields are written in.
+type HeaderOrder int
+
+const (
+	// InsertionOrder writes fields in the order they were first added.
+	InsertionOrder HeaderOrder = iota
+	// SortedOrder writes fields sorted by case-insensitive name, for output
+	// that has to be byte-for-byte comparable however it was built.
+	SortedOrder
+)
+
 func NewResponse(w io.Writer) Writer {
 	return Writer{
 		Writer: w,
-		WriterState: WriterState{
+		WriterState: &WriterState{
 			statusLineWritten: false,
 			headersWritten:    false,
 			bodyWritten:       false,
@@ -29,75 +83,213 @@ func NewResponse(w io.Writer) Writer {
 	}
 }
 
-type StatusCode int
+// CloseAfterResponse marks this response as the last one on the connection.
+// If the headers have not been written yet, a "Connection: close" header is
+// added when they are.
+func (w *Writer) CloseAfterResponse() {
+	w.WriterState.closeConn = true
+}
 
-const (
-	Success             StatusCode = 200
-	BadRequest          StatusCode = 400
-	InternalServerError StatusCode = 500
-)
+// ShouldClose reports whether the connection must be closed once the handler
+// returns, either because the server asked for it or because the handler
+// sent "Connection: close" or an unframed body.
+func (w *Writer) ShouldClose() bool {
+	return w.WriterState.closeConn
+}
 
-func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
-	switch statusCode {
-	case Success:
-		_, err := fmt.Fprintf(w, "HTTP/1.1 200 OK\r\n")
-		if err != nil {
-			return err
-		}
-		return nil
-	case BadRequest:
-		_, err := fmt.Fprintf(w, "HTTP/1.1 400 Bad Request\r\n")
-		if err != nil {
-			return err
-		}
-		return nil
-	case InternalServerError:
-		_, err := fmt.Fprintf(w, "HTTP/1.1 500 Internal Server Error\r\n")
-		if err != nil {
-			return err
-		}
+// StatusCode returns the status written so far, or 0 if the status line has
+// not been written yet. A handler that started the body without a status
+// line gets 200.
+func (w *Writer) StatusCode() StatusCode {
+	return w.WriterState.statusCode
+}
+
+// Headers returns the headers as they were written, or nil before
+// WriteHeaders.
+func (w *Writer) Headers() headers.Headers {
+	return w.WriterState.headers
+}
+
+// SetHTTPVersion records the version of the request being answered. For
+// "1.0" the status line is downgraded, chunked encoding is replaced by a
+// close-delimited body and the connection is only kept open if the client
+// asked for keep-alive.
+func (w *Writer) SetHTTPVersion(version string) {
+	w.WriterState.httpVersion = version
+}
+
+// SetMethod records the method of the request being answered. For HEAD
+// the headers go out as they would for GET, Content-Length included, but
+// body bytes are counted instead of sent.
+func (w *Writer) SetMethod(method string) {
+	w.WriterState.method = method
+}
+
+// SetHeaderOrder sets the order used by WriteHeaders, WriteTrailers and
+// WriteInformational. Repeated values of a field always keep the order
+// they were added in.
+func (w *Writer) SetHeaderOrder(order HeaderOrder) {
+	w.WriterState.headerOrder = order
+}
+
+// ExpectContinue records that the client is holding its body back until it
+// receives "100 Continue". If a final status is written before
+// WriteContinue, the body was never asked for and the connection is closed
+// after the response, since the client may or may not send it anyway.
+func (w *Writer) ExpectContinue() {
+	w.WriterState.continuePending = true
+}
+
+// WriteContinue sends "100 Continue" if the client is waiting for it and no
+// final response has been started. Servers call it when the handler first
+// reads the body.
+func (w *Writer) WriteContinue() error {
+	if !w.WriterState.continuePending || w.WriterState.statusLineWritten {
 		return nil
-	default:
-		_, err := fmt.Fprintf(w, "HTTP/1.1 %d \r\n", statusCode)
-		if err != nil {
-			return err
-		}
+	}
+	w.WriterState.continuePending = false
+	return w.WriteInformational(Continue, nil)
+}
+
+// WriteInformational sends an interim 1xx response, such as 103 Early Hints,
+// ahead of the final one. HTTP/1.0 clients do not understand 1xx responses,
+// so nothing is sent to them.
+func (w *Writer) WriteInformational(statusCode StatusCode, h headers.Headers) error {
+	if statusCode < 100 || statusCode > 199 || statusCode == 101 {
+		return fmt.Errorf("%d is not an informational status", statusCode)
+	}
+	if w.WriterState.statusLineWritten {
+		return fmt.Errorf("Status line already written")
+	}
+	if w.isHTTP10() {
 		return nil
 	}
+	err := writeStatusLine(w.Writer, "1.1", statusCode, StatusText(statusCode))
+	if err != nil {
+		return err
+	}
+	if err := writeFieldSection(w.Writer, h, w.WriterState.headerOrder); err != nil {
+		return err
+	}
+	// An interim response is only useful if it arrives ahead of the final
+	// one; a client waiting on 100 Continue would wait forever.
+	if err := w.flushConn(); err != nil {
+		return err
+	}
+	// The buffer held nothing else, so none of the final response is out
+	// and Discard can still replace it.
+	w.WriterState.conn.sent = false
+	return nil
 }
 
-func GetDefaultHeaders(content int) headers.Headers {
+func (w *Writer) isHTTP10() bool {
+	return w.WriterState.httpVersion == "1.0"
+}
 
-	return headers.Headers{
-		"Content-Type":   "text/plain",
-		"Content-Length": fmt.Sprintf("%d", content),
-		"Connection":     "close",
-	}
+func (w *Writer) isHEAD() bool {
+	return w.WriterState.method == "HEAD"
 }
 
-func WriteHeaders(w io.Writer, headers headers.Headers) error {
-	for key, value := range headers {
-		_, err := fmt.Fprintf(w, "%s: %s\r\n", key, value)
-		if err != nil {
-			return err
-		}
+func (w *Writer) StatusLineWritten() bool {
+	return w.WriterState.statusLineWritten
+}
+
+func (w *Writer) HeadersWritten() bool {
+	return w.WriterState.headersWritten
+}
+
+// WriteStatusLine writes an HTTP/1.1 status line with the registered reason
+// phrase. Codes without one get an empty reason, which clients accept.
+func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
+	return writeStatusLine(w, "1.1", statusCode, StatusText(statusCode))
+}
+
+func writeStatusLine(w io.Writer, httpVersion string, statusCode StatusCode, reason string) error {
+	if err := checkStatus(statusCode); err != nil {
+		return err
 	}
-	_, err := fmt.Fprintf(w, "\r\n")
+	if err := checkReason(reason); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "HTTP/%s %d %s\r\n", httpVersion, statusCode, reason)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func GetDefaultHeaders(content int) headers.Headers {
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Content-Length", fmt.Sprintf("%d", content))
+	return h
+}
+
+// prepareConnection reconciles the Connection header with the connection
+// state: a body without Content-Length or chunked framing is delimited by
+// closing the connection, and a close requested by either side is announced.
+// HTTP/1.0 clients cannot parse chunked encoding, so for them it is removed
+// and the body becomes close-delimited.
+func (w *Writer) prepareConnection(h headers.Headers) {
+	closeRequested := h.HasToken("Connection", "close")
+	if closeRequested {
+		w.WriterState.closeConn = true
+	}
+	chunked := h.HasToken("Transfer-Encoding", "chunked")
+	if chunked {
+		w.WriterState.chunkState = chunkData
+		w.WriterState.declaredTrailers = h.List("Trailer")
+	}
+	if w.isHTTP10() && chunked {
+		h.Del("Transfer-Encoding")
+		h.Del("Trailer")
+		w.WriterState.unchunked = true
+		chunked = false
+	}
+	if !h.Has("Content-Length") && !chunked && bodyAllowed(w.WriterState.statusCode) && !w.isHEAD() {
+		w.WriterState.closeConn = true
+	}
+
+	switch {
+	case w.WriterState.closeConn && !closeRequested:
+		h.Set("Connection", "close")
+	case !w.WriterState.closeConn && w.isHTTP10():
+		// 1.0 connections are only persistent when both sides say so.
+		h.Set("Connection", "keep-alive")
+	}
+}
+
+// WriteHeaders writes each field in insertion order followed by the blank
+// line ending the header section. Repeated fields go out as one line per
+// value. A field that is not safe to write fails with a
+// *headers.FieldError.
+func WriteHeaders(w io.Writer, headers headers.Headers) error {
+	return writeFieldSection(w, headers, InsertionOrder)
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason is WriteStatusLine with a reason phrase of the
+// caller's choosing, for relaying a status exactly as an upstream sent it.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
 	if w.WriterState.statusLineWritten {
 		return fmt.Errorf("Status line already written")
 	}
-	err := WriteStatusLine(w.Writer, statusCode)
+	version := "1.1"
+	if w.isHTTP10() {
+		version = "1.0"
+	}
+	err := writeStatusLine(w.Writer, version, statusCode, reason)
 	if err != nil {
 		return err
 	}
+	if w.WriterState.continuePending {
+		w.WriterState.closeConn = true
+	}
 	w.WriterState.statusLineWritten = true
+	w.WriterState.statusCode = statusCode
 	return nil
 }
 
@@ -108,11 +300,19 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 	if w.WriterState.headersWritten {
 		return fmt.Errorf("Headers already written")
 	}
-	err := WriteHeaders(w.Writer, headers)
+	w.mergePending(headers)
+	return w.writeHeaders(headers)
+}
+
+func (w *Writer) writeHeaders(headers headers.Headers) error {
+	w.addDefaultHeaders(headers)
+	w.prepareConnection(headers)
+	err := writeFieldSection(w.Writer, headers, w.WriterState.headerOrder)
 	if err != nil {
 		return err
 	}
 	w.WriterState.headersWritten = true
+	w.WriterState.headers = headers
 	return nil
 }
 
@@ -126,65 +326,42 @@ func (w *Writer) WriteBody(body []byte) (int, error) {
 	if w.WriterState.bodyWritten {
 		return 0, fmt.Errorf("Body already written")
 	}
-	_, err := w.Writer.Write(body)
-	if err != nil {
-		return 0, err
+	if !w.isHEAD() {
+		if _, err := w.Writer.Write(body); err != nil {
+			return 0, err
+		}
 	}
 	w.WriterState.bodyWritten = true
 	return len(body), nil
 }
 
-func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
-	if !w.WriterState.statusLineWritten {
-		return 0, fmt.Errorf("Status line not written")
-	}
-	if !w.WriterState.headersWritten {
-		return 0, fmt.Errorf("Headers not written")
-	}
-
-	w.Writer.Write([]byte(fmt.Sprintf("%x\r\n", len(p))))
-	n, err := w.Writer.Write(p)
-	if err != nil {
-		return n, err
-	}
-	n, err = w.Writer.Write([]byte("\r\n"))
-	if err != nil {
-		return n, err
-	}
-	return n, nil
-}
-
-func (w *Writer) WriteChunkedBodyEnd() error {
-	if !w.WriterState.statusLineWritten {
-		return fmt.Errorf("Status line not written")
-	}
-	if !w.WriterState.headersWritten {
-		return fmt.Errorf("Headers not written")
+// writeFieldSection writes a header or trailer section, ending with the
+// blank line. Nothing is written if any field is invalid, so a bad value
+// cannot smuggle in fields or split the response.
+func writeFieldSection(w io.Writer, h headers.Headers, order HeaderOrder) error {
+	if err := h.Validate(); err != nil {
+		return err
 	}
-
-	_, err := w.Writer.Write([]byte("0\r\n"))
-	if err != nil {
+	if err := writeFields(w, h, order); err != nil {
 		return err
 	}
-	return nil
+	_, err := fmt.Fprintf(w, "\r\n")
+	return err
 }
 
-func (w *Writer) WriteTrailers(trailers headers.Headers) error {
-	if !w.WriterState.statusLineWritten {
-		return fmt.Errorf("Status line not written")
+func writeFields(w io.Writer, h headers.Headers, order HeaderOrder) error {
+	var err error
+	rangeFields := h.Range
+	if order == SortedOrder {
+		rangeFields = h.RangeSorted
 	}
-	if !w.WriterState.headersWritten {
-		return fmt.Errorf("Headers not written")
-	}
-	for key, value := range trailers {
-		_, err := fmt.Fprintf(w.Writer, "%s: %s\r\n", key, value)
-		if err != nil {
-			return err
+	rangeFields(func(name string, values []string) bool {
+		for _, value := range values {
+			if _, err = fmt.Fprintf(w, "%s: %s\r\n", name, value); err != nil {
+				return false
+			}
 		}
-	}
-	_, err := fmt.Fprintf(w.Writer, "\r\n")
-	if err != nil {
-		return err
-	}
-	return nil
+		return true
+	})
+	return err
 }
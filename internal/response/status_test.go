@@ -0,0 +1,61 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusText(t *testing.T) {
+	assert.Equal(t, "OK", StatusText(Success))
+	assert.Equal(t, "Not Found", StatusText(NotFound))
+	assert.Equal(t, "Range Not Satisfiable", StatusText(RangeNotSatisfiable))
+	assert.Equal(t, "Network Authentication Required", StatusText(NetworkAuthenticationRequired))
+	assert.Equal(t, "", StatusText(299))
+}
+
+func TestWriteStatusLine(t *testing.T) {
+	// Test: Registered code
+	var buf bytes.Buffer
+	require.NoError(t, WriteStatusLine(&buf, NotFound))
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", buf.String())
+
+	// Test: Unregistered code in range keeps an empty reason
+	buf.Reset()
+	require.NoError(t, WriteStatusLine(&buf, 299))
+	assert.Equal(t, "HTTP/1.1 299 \r\n", buf.String())
+
+	// Test: Out of range codes are rejected
+	for _, code := range []StatusCode{0, 99, 600, 1000, -200} {
+		buf.Reset()
+		assert.ErrorIs(t, WriteStatusLine(&buf, code), ErrInvalidStatusCode, "%d", code)
+		assert.Empty(t, buf.String())
+	}
+}
+
+func TestWriter_WriteStatusLineReason(t *testing.T) {
+	// Test: Custom reason
+	var buf bytes.Buffer
+	w := NewResponse(&buf)
+	require.NoError(t, w.WriteStatusLineReason(418, "I'm a teapot"))
+	assert.Equal(t, "HTTP/1.1 418 I'm a teapot\r\n", buf.String())
+	assert.Equal(t, StatusCode(418), w.StatusCode())
+
+	// Test: Reasons that would break the status line
+	for _, reason := range []string{"Bad\r\nX-Injected: 1", "Nul\x00", "Del\x7f"} {
+		buf.Reset()
+		w := NewResponse(&buf)
+		assert.ErrorIs(t, w.WriteStatusLineReason(Success, reason), ErrInvalidReason, "%q", reason)
+		assert.False(t, w.StatusLineWritten())
+		assert.Empty(t, buf.String())
+	}
+
+	// Test: HTTP/1.0 responses keep the custom reason
+	buf.Reset()
+	w = NewResponse(&buf)
+	w.SetHTTPVersion("1.0")
+	require.NoError(t, w.WriteStatusLineReason(BadGateway, "Upstream\tDown"))
+	assert.Equal(t, "HTTP/1.0 502 Upstream\tDown\r\n", buf.String())
+}
@@ -0,0 +1,34 @@
+package router
+
+import "github.com/GhostVox/httptcp/internal/server"
+
+// Group registers routes on a Router under a shared path prefix.
+type Group struct {
+	router *Router
+	prefix string
+}
+
+func (g *Group) Handle(method, pattern string, handler server.Handler) {
+	g.router.Handle(method, g.prefix+pattern, handler)
+}
+
+func (g *Group) Get(pattern string, handler server.Handler) {
+	g.Handle("GET", pattern, handler)
+}
+
+func (g *Group) Post(pattern string, handler server.Handler) {
+	g.Handle("POST", pattern, handler)
+}
+
+func (g *Group) Put(pattern string, handler server.Handler) {
+	g.Handle("PUT", pattern, handler)
+}
+
+func (g *Group) Delete(pattern string, handler server.Handler) {
+	g.Handle("DELETE", pattern, handler)
+}
+
+// Group returns a nested group under this group's prefix.
+func (g *Group) Group(prefix string) *Group {
+	return g.router.Group(g.prefix + prefix)
+}
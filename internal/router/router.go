@@ -0,0 +1,260 @@
+// Package router dispatches requests to handlers by method and path
+// pattern.
+//
+// Patterns are slash separated. A segment is either a literal, a parameter
+// such as {id} that matches exactly one segment, or, in last position only,
+// a wildcard such as {path...} that matches the rest of the path, including
+// nothing at all. When several patterns match, literals beat parameters and
+// parameters beat wildcards, segment by segment from the left.
+package router
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+	"github.com/GhostVox/httptcp/internal/server"
+)
+
+type segmentKind int
+
+// Ordered from least to most specific.
+const (
+	segmentWildcard segmentKind = iota
+	segmentParam
+	segmentLiteral
+)
+
+type segment struct {
+	kind  segmentKind
+	value string // literal text or parameter name
+}
+
+type route struct {
+	method   string // empty matches any method
+	pattern  string
+	segments []segment
+	handler  server.Handler
+}
+
+type Router struct {
+	routes []*route
+	// NotFound is called when no pattern matches the path. By default a
+	// plain 404 is written.
+	NotFound server.Handler
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for method and pattern. An empty method matches
+// every method. It panics on malformed patterns and duplicate registrations,
+// which are programming errors.
+func (r *Router) Handle(method, pattern string, handler server.Handler) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("router: %v", err))
+	}
+	for _, existing := range r.routes {
+		if existing.method == method && existing.pattern == pattern {
+			panic(fmt.Sprintf("router: %s %s registered twice", method, pattern))
+		}
+	}
+	r.routes = append(r.routes, &route{
+		method:   method,
+		pattern:  pattern,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+func (r *Router) Get(pattern string, handler server.Handler) {
+	r.Handle("GET", pattern, handler)
+}
+
+func (r *Router) Post(pattern string, handler server.Handler) {
+	r.Handle("POST", pattern, handler)
+}
+
+func (r *Router) Put(pattern string, handler server.Handler) {
+	r.Handle("PUT", pattern, handler)
+}
+
+func (r *Router) Delete(pattern string, handler server.Handler) {
+	r.Handle("DELETE", pattern, handler)
+}
+
+// Group returns a Group whose patterns are registered under prefix.
+func (r *Router) Group(prefix string) *Group {
+	return &Group{router: r, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// ServeRequest has the server.Handler signature, so a Router can be passed
+// straight to server.Serve. A HEAD request that no route takes goes to the
+// GET route instead; the response writer leaves out the body.
+func (r *Router) ServeRequest(w response.Writer, req *request.Request) {
+	path := splitPath(req.Path())
+
+	best, bestParams, allowed := r.lookup(path, req.RequestLine.Method)
+	if best == nil && req.RequestLine.Method == "HEAD" {
+		best, bestParams, _ = r.lookup(path, "GET")
+	}
+	if allowed["GET"] {
+		allowed["HEAD"] = true
+	}
+
+	switch {
+	case best != nil:
+		if len(bestParams) > 0 {
+			req = req.WithContext(context.WithValue(req.Context(), paramsKey{}, bestParams))
+		}
+		best.handler(w, req)
+	case len(allowed) > 0:
+		methodNotAllowed(w, allowed)
+	case r.NotFound != nil:
+		r.NotFound(w, req)
+	default:
+		notFound(w)
+	}
+}
+
+// lookup finds the most specific route for path and method. When none
+// takes the method, allowed holds the methods that would have matched.
+func (r *Router) lookup(path []string, method string) (*route, map[string]string, map[string]bool) {
+	var best *route
+	var bestParams map[string]string
+	allowed := map[string]bool{}
+	for _, rt := range r.routes {
+		params, ok := rt.match(path)
+		if !ok {
+			continue
+		}
+		if rt.method != "" && rt.method != method {
+			allowed[rt.method] = true
+			continue
+		}
+		if best == nil || rt.moreSpecific(best) {
+			best, bestParams = rt, params
+		}
+	}
+	return best, bestParams, allowed
+}
+
+type paramsKey struct{}
+
+// Param returns the value of the named path parameter, or "" if the route
+// that matched req did not declare it.
+func Param(req *request.Request, name string) string {
+	params, _ := req.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %q must start with /", pattern)
+	}
+	parts := splitPath(pattern)
+	segments := make([]segment, 0, len(parts))
+	seen := map[string]bool{}
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("pattern %q: malformed segment %q", pattern, part)
+			}
+			segments = append(segments, segment{kind: segmentLiteral, value: part})
+			continue
+		}
+		name := part[1 : len(part)-1]
+		kind := segmentParam
+		if strings.HasSuffix(name, "...") {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("pattern %q: wildcard must be the last segment", pattern)
+			}
+			name = strings.TrimSuffix(name, "...")
+			kind = segmentWildcard
+		}
+		if name == "" || strings.ContainsAny(name, "{}") {
+			return nil, fmt.Errorf("pattern %q: malformed segment %q", pattern, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("pattern %q: duplicate parameter %q", pattern, name)
+		}
+		seen[name] = true
+		segments = append(segments, segment{kind: kind, value: name})
+	}
+	return segments, nil
+}
+
+func (rt *route) match(path []string) (map[string]string, bool) {
+	var params map[string]string
+	for i, seg := range rt.segments {
+		if seg.kind == segmentWildcard {
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[seg.value] = strings.Join(path[i:], "/")
+			return params, true
+		}
+		if i >= len(path) {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentLiteral:
+			if path[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if path[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[seg.value] = path[i]
+		}
+	}
+	if len(path) != len(rt.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// moreSpecific reports whether rt should win over other when both match.
+func (rt *route) moreSpecific(other *route) bool {
+	for i := 0; i < len(rt.segments) && i < len(other.segments); i++ {
+		if rt.segments[i].kind != other.segments[i].kind {
+			return rt.segments[i].kind > other.segments[i].kind
+		}
+	}
+	if len(rt.segments) != len(other.segments) {
+		return len(rt.segments) > len(other.segments)
+	}
+	return rt.method != "" && other.method == ""
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+func notFound(w response.Writer) {
+	w.WriteStatusLine(response.NotFound)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("Not Found\n"))
+}
+
+func methodNotAllowed(w response.Writer, allowed map[string]bool) {
+	methods := make([]string, 0, len(allowed))
+	for method := range allowed {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	w.WriteStatusLine(response.MethodNotAllowed)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.Write([]byte("Method Not Allowed\n"))
+}
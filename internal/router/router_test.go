@@ -0,0 +1,146 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+	"github.com/GhostVox/httptcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// named returns a handler that writes its name and the given parameters.
+func named(name string, params ...string) server.Handler {
+	return func(w response.Writer, req *request.Request) {
+		body := name
+		for _, p := range params {
+			body += " " + p + "=" + Param(req, p)
+		}
+		w.WriteStatusLine(response.Success)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	}
+}
+
+func serve(t *testing.T, r *Router, method, target string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewResponse(&buf)
+	w.SetMethod(method)
+	r.ServeRequest(w, req)
+	// The server finishes every response once the handler returns.
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func TestRouter_Dispatch(t *testing.T) {
+	r := New()
+	r.Get("/", named("root"))
+	r.Get("/users", named("users"))
+	r.Get("/users/{id}", named("user", "id"))
+	r.Get("/users/me", named("me"))
+	r.Post("/users/{id}/posts/{post}", named("post", "id", "post"))
+	r.Handle("", "/static/{path...}", named("static", "path"))
+	r.Handle("", "/any", named("any"))
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{"GET", "/", "root"},
+		{"GET", "/users", "users"},
+		{"GET", "/users/42", "user id=42"},
+		{"GET", "/users/42?verbose=1", "user id=42"},
+		{"GET", "/users/me", "me"},
+		{"POST", "/users/7/posts/hello", "post id=7 post=hello"},
+		{"GET", "/static/css/site.css", "static path=css/site.css"},
+		{"DELETE", "/static/", "static path="},
+		{"PATCH", "/any", "any"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.target, func(t *testing.T) {
+			out := serve(t, r, tc.method, tc.target)
+			assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+			assert.True(t, strings.HasSuffix(out, "\r\n\r\n"+tc.body), out)
+		})
+	}
+}
+
+func TestRouter_NotFoundAndMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.Get("/users/{id}", named("user"))
+	r.Delete("/users/{id}", named("delete"))
+
+	out := serve(t, r, "GET", "/nope")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"), out)
+
+	out = serve(t, r, "GET", "/users/")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"), out)
+
+	out = serve(t, r, "POST", "/users/1")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 405 Method Not Allowed\r\n"), out)
+	assert.Contains(t, out, "Allow: DELETE, GET, HEAD\r\n")
+
+	r.NotFound = named("custom")
+	out = serve(t, r, "GET", "/nope")
+	assert.True(t, strings.HasSuffix(out, "custom"), out)
+}
+
+func TestRouter_HeadFallsBackToGet(t *testing.T) {
+	r := New()
+	r.Get("/users/{id}", named("user", "id"))
+	r.Get("/page", named("page"))
+	r.Handle("HEAD", "/page", func(w response.Writer, req *request.Request) {
+		w.Header().Set("X-Head", "1")
+		w.WriteStatusLine(response.Success)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+
+	out := serve(t, r, "HEAD", "/users/42")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+	assert.Contains(t, out, "Content-Length: 10\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"), out)
+
+	// A HEAD route of its own wins over the GET one.
+	out = serve(t, r, "HEAD", "/page")
+	assert.Contains(t, out, "X-Head: 1\r\n")
+
+	out = serve(t, r, "POST", "/users/42")
+	assert.Contains(t, out, "Allow: GET, HEAD\r\n")
+}
+
+func TestRouter_Groups(t *testing.T) {
+	r := New()
+	api := r.Group("/api/")
+	api.Get("/health", named("health"))
+	v1 := api.Group("/v1")
+	v1.Get("/items/{id}", named("item", "id"))
+
+	out := serve(t, r, "GET", "/api/health")
+	assert.True(t, strings.HasSuffix(out, "health"), out)
+	out = serve(t, r, "GET", "/api/v1/items/9")
+	assert.True(t, strings.HasSuffix(out, "item id=9"), out)
+}
+
+func TestRouter_InvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{
+		"users",
+		"/users/{}",
+		"/users/{id",
+		"/files/{path...}/edit",
+		"/users/{id}/{id}",
+	} {
+		assert.Panics(t, func() { New().Get(pattern, named("x")) }, pattern)
+	}
+
+	r := New()
+	r.Get("/dup", named("x"))
+	assert.Panics(t, func() { r.Get("/dup", named("x")) })
+	assert.NotPanics(t, func() { r.Post("/dup", named("x")) })
+}
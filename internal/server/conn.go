@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/GhostVox/httptcp/internal/request"
+)
+
+// aLongTimeAgo is a deadline in the past, used to wake up a blocked read.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// connWatcher notices a client hanging up while its handler is still
+// running and cancels the request context. It can only start reading once
+// the request body has been consumed, because until then the handler owns
+// the read side of the connection. Anything it reads stays buffered in the
+// request reader as the start of the next request.
+type connWatcher struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	stopped bool
+	quit    chan struct{}
+	done    chan struct{}
+	gone    bool
+}
+
+func watchConn(conn net.Conn, reader *request.Reader, cancel context.CancelFunc) *connWatcher {
+	w := &connWatcher{
+		conn: conn,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	bodyDone := reader.BodyDone()
+	go func() {
+		defer close(w.done)
+		select {
+		case <-bodyDone:
+		case <-w.quit:
+			return
+		}
+		w.mu.Lock()
+		if w.stopped {
+			w.mu.Unlock()
+			return
+		}
+		w.conn.SetReadDeadline(time.Time{})
+		w.mu.Unlock()
+
+		if err := reader.WaitForData(); err != nil && !isTimeout(err) {
+			w.gone = true
+			cancel()
+		}
+	}()
+	return w
+}
+
+// stop interrupts the background read and reports whether the client was
+// found to have gone away.
+func (w *connWatcher) stop() bool {
+	w.mu.Lock()
+	w.stopped = true
+	close(w.quit)
+	w.conn.SetReadDeadline(aLongTimeAgo)
+	w.mu.Unlock()
+	<-w.done
+	w.conn.SetReadDeadline(time.Time{})
+	return w.gone
+}
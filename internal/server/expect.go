@@ -0,0 +1,55 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+)
+
+var errContinueNotSent = errors.New("body was never requested from an expect-continue client")
+
+// continueBody sends "100 Continue" the first time the handler reads from
+// the body, so a client waiting on Expect only sends its body when the
+// handler actually wants it.
+type continueBody struct {
+	io.ReadCloser
+	w    response.Writer
+	read bool
+}
+
+func (b *continueBody) Read(p []byte) (int, error) {
+	if !b.read {
+		b.read = true
+		if err := b.w.WriteContinue(); err != nil {
+			return 0, err
+		}
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// Close leaves an unrequested body on the wire: the client may never send
+// it, so draining could block, and the connection has to be closed instead.
+func (b *continueBody) Close() error {
+	if !b.read {
+		return errContinueNotSent
+	}
+	return b.ReadCloser.Close()
+}
+
+// expectation inspects the Expect header. It reports whether the client is
+// waiting for 100 Continue, and false for ok if it asked for something we
+// cannot meet. HTTP/1.0 clients cannot take a 1xx response, so their
+// expectations are ignored as RFC 9110 section 10.1.1 requires.
+func expectation(req *request.Request) (waitForContinue bool, ok bool) {
+	expect := req.Headers.Get("Expect")
+	if expect == "" || req.IsHTTP10() {
+		return false, true
+	}
+	if strings.EqualFold(strings.TrimSpace(expect), "100-continue") {
+		return true, true
+	}
+	return false, false
+}
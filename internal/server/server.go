@@ -1,11 +1,18 @@
 package server
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"io"
 	"log"
 	"net"
+	"runtime/debug"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/GhostVox/httptcp/internal/request"
 	"github.com/GhostVox/httptcp/internal/response"
@@ -16,73 +23,513 @@ type Handler func(w response.Writer, req *request.Request)
 type HandlerError struct {
 	Message    string
 	StatusCode response.StatusCode
+	// HTTPVersion is the version of the request being answered; for "1.0"
+	// the status line is downgraded to match.
+	HTTPVersion string
+	// Method is the method of the request being answered; HEAD gets the
+	// headers without the message.
+	Method string
 }
 
+// Write sends the error as a complete response that closes the
+// connection.
 func (he HandlerError) Write(w io.Writer) {
-	response.WriteStatusLine(w, he.StatusCode)
+	writer := response.NewResponse(w)
+	writer.SetHTTPVersion(he.HTTPVersion)
+	writer.SetMethod(he.Method)
+	writer.CloseAfterResponse()
+	writer.WriteStatusLine(he.StatusCode)
 	messageBytes := []byte(he.Message)
-	headers := response.GetDefaultHeaders(len(messageBytes))
-	response.WriteHeaders(w, headers)
-	w.Write(messageBytes)
+	writer.WriteHeaders(response.GetDefaultHeaders(len(messageBytes)))
+	writer.WriteBody(messageBytes)
 }
 
+const (
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultMaxPipelineDepth  = 16
+	defaultServerName        = "httptcp"
+)
+
 type Server struct {
 	port    int
 	server  net.Listener
 	handler Handler
 	closed  atomic.Bool
+	// ctx is the parent of every request context and is cancelled when the
+	// server stops.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	errorLog *log.Logger
+
+	mu         sync.Mutex
+	conns      map[net.Conn]trackedConn
+	onShutdown []func()
+
+	idleTimeout        time.Duration
+	readHeaderTimeout  time.Duration
+	readBodyTimeout    time.Duration
+	writeTimeout       time.Duration
+	maxRequestsPerConn int
+	maxPipelineDepth   int
+	parserConfig       request.ParserConfig
+	headerOrder        response.HeaderOrder
+	responseBufferSize int
+	serverName         string
+}
+
+// Option configures a Server before it starts accepting connections.
+type Option func(*Server)
+
+// WithIdleTimeout sets how long a keep-alive connection may sit between
+// requests before it is closed. Zero disables the timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// WithReadHeaderTimeout bounds how long a client may take to send the
+// request line and headers once it has started a request. Zero disables the
+// timeout.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readHeaderTimeout = d
+	}
+}
+
+// WithReadBodyTimeout bounds how long reading the request body may take,
+// counted from the end of the headers. Zero disables the timeout.
+func WithReadBodyTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readBodyTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds how long the handler may take to write the
+// response, counted from the end of the headers. Zero disables the timeout,
+// which is what long streaming responses need.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+// WithMaxRequestsPerConn caps how many requests are served on a single
+// connection. The last response carries "Connection: close". Zero means no
+// limit.
+func WithMaxRequestsPerConn(n int) Option {
+	return func(s *Server) {
+		s.maxRequestsPerConn = n
+	}
+}
+
+// WithMaxPipelineDepth caps how many requests a client may pipeline, that is
+// send before reading the responses to earlier ones. When the cap is hit the
+// response carries "Connection: close" and the client has to retry the rest
+// on a new connection. Zero means no limit.
+func WithMaxPipelineDepth(n int) Option {
+	return func(s *Server) {
+		s.maxPipelineDepth = n
+	}
+}
+
+// WithParserConfig sets the limits the request parser enforces on every
+// connection.
+func WithParserConfig(config request.ParserConfig) Option {
+	return func(s *Server) {
+		s.parserConfig = config
+	}
+}
+
+// WithHeaderOrder sets the order response headers and trailers are written
+// in. The default is the order the handler added them.
+func WithHeaderOrder(order response.HeaderOrder) Option {
+	return func(s *Server) {
+		s.headerOrder = order
+	}
+}
+
+// WithResponseBufferSize sets how much of a body written through
+// response.Writer.Write is buffered before the response switches from
+// Content-Length to chunked encoding. Zero means
+// response.DefaultBufferSize.
+func WithResponseBufferSize(n int) Option {
+	return func(s *Server) {
+		s.responseBufferSize = n
+	}
+}
+
+// WithServerName sets the Server header sent with every response that does
+// not set its own. An empty name leaves the header out.
+func WithServerName(name string) Option {
+	return func(s *Server) {
+		s.serverName = name
+	}
+}
+
+// WithErrorLog routes accept errors, recovered panics and other connection
+// level failures to logger. By default they go to the standard logger.
+func WithErrorLog(logger *log.Logger) Option {
+	return func(s *Server) {
+		s.errorLog = logger
+	}
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
 
 	tcpListener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
 	if err != nil {
 		return nil, err
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	server := &Server{
-		port:    port,
-		server:  tcpListener,
-		handler: handler,
-		closed:  atomic.Bool{},
+		port:              port,
+		server:            tcpListener,
+		handler:           handler,
+		closed:            atomic.Bool{},
+		ctx:               ctx,
+		cancel:            cancel,
+		idleTimeout:       defaultIdleTimeout,
+		readHeaderTimeout: defaultReadHeaderTimeout,
+		maxPipelineDepth:  defaultMaxPipelineDepth,
+		parserConfig:      request.DefaultParserConfig(),
+		serverName:        defaultServerName,
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
 	go server.listen()
 	return server, nil
 
 }
 
+// Close stops the server immediately: the listener and every connection
+// are closed and request contexts are cancelled. Use Shutdown to let
+// in-flight requests finish.
 func (s *Server) Close() error {
 	s.closed.Store(true)
-	return s.server.Close()
-
+	err := s.server.Close()
+	s.closeAllConns()
+	return err
 }
 
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// listen accepts connections until the server is closed. Errors that can
+// clear up on their own, such as running out of file descriptors, are
+// retried with exponential backoff instead of taking the process down.
 func (s *Server) listen() {
+	var backoff time.Duration
 	for {
 		conn, err := s.server.Accept()
 		if err != nil {
 			if s.closed.Load() {
 				return
 			}
-			log.Fatal("Failed to accept connection")
+			if !isTemporary(err) {
+				s.logf("server: accept failed, no longer accepting connections: %v", err)
+				return
+			}
+			if backoff == 0 {
+				backoff = minAcceptBackoff
+			} else {
+				backoff = min(backoff*2, maxAcceptBackoff)
+			}
+			s.logf("server: accept error: %v; retrying in %v", err, backoff)
+			time.Sleep(backoff)
+			continue
 		}
+		backoff = 0
+		// Tracked before Handle starts, so a Shutdown from here on waits
+		// for the connection instead of missing it.
+		s.trackConn(conn, stateNew)
 		go s.Handle(conn)
 	}
 }
 
+func (s *Server) logf(format string, args ...any) {
+	if s.errorLog != nil {
+		s.errorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Handle serves requests on conn until either side asks to close the
+// connection, a timeout expires or the per-connection request limit is
+// reached. Pipelined requests are parsed from the bytes carried over by the
+// request reader and answered one at a time, so responses always go out in
+// request order.
 func (s *Server) Handle(conn net.Conn) {
 	defer conn.Close()
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
+	defer func() {
+		if v := recover(); v != nil {
+			s.logf("server: panic on connection from %v: %v\n%s", conn.RemoteAddr(), v, debug.Stack())
+		}
+	}()
+	s.trackConn(conn, stateNew)
+	defer s.untrackConn(conn)
+	reader := request.NewReaderWithConfig(conn, s.parserConfig)
+	requests := 0
+	depth := 0
+	for {
+		// Bytes that arrived before the previous response was written mean
+		// the client is pipelining.
+		if reader.Buffered() > 0 {
+			depth++
+		} else {
+			depth = 1
+		}
+
+		// The idle timeout covers the wait for the first byte of the next
+		// request, the header timeout everything up to the end of headers.
+		waitTimeout := s.readHeaderTimeout
+		if requests > 0 {
+			waitTimeout = s.idleTimeout
+		}
+		setReadDeadline(conn, waitTimeout)
+		if requests > 0 {
+			s.trackConn(conn, stateIdle)
+		}
+		if err := reader.WaitForData(); err != nil {
+			return
+		}
+		s.trackConn(conn, stateActive)
+		setReadDeadline(conn, s.readHeaderTimeout)
+		req, err := reader.ReadRequest()
+		if err != nil {
+			if errors.Is(err, io.EOF) || isTimeout(err) {
+				return
+			}
+			setWriteDeadline(conn, s.writeTimeout)
+			hErr := &HandlerError{
+				StatusCode:  statusForError(err),
+				Message:     err.Error(),
+				HTTPVersion: reader.HTTPVersion(),
+			}
+			hErr.Write(conn)
+			return
+		}
+		requests++
+
+		closeAfter := !req.KeepAlive() || s.closed.Load() ||
+			(s.maxRequestsPerConn > 0 && requests >= s.maxRequestsPerConn) ||
+			(s.maxPipelineDepth > 0 && depth >= s.maxPipelineDepth)
+		if !s.serveRequest(conn, reader, req, closeAfter) || closeAfter || s.closed.Load() {
+			return
+		}
+	}
+}
+
+// serveRequest runs the handler for one request and reports whether the
+// connection can be reused afterwards.
+func (s *Server) serveRequest(conn net.Conn, reader *request.Reader, req *request.Request, closeAfter bool) bool {
+	ctx, cancel := context.WithCancel(s.baseContext())
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	setReadDeadline(conn, s.readBodyTimeout)
+	setWriteDeadline(conn, s.writeTimeout)
+	watcher := watchConn(conn, reader, cancel)
+
+	// The response is buffered so the status line, headers and chunk
+	// framing share writes; Release flushes it and recycles the buffer.
+	writer := response.NewBufferedResponse(conn)
+	defer writer.Release()
+	writer.SetHTTPVersion(req.RequestLine.HttpVersion)
+	writer.SetMethod(req.RequestLine.Method)
+	writer.SetHeaderOrder(s.headerOrder)
+	writer.SetBufferSize(s.responseBufferSize)
+	writer.SetServerName(s.serverName)
+	if closeAfter {
+		writer.CloseAfterResponse()
+	}
+
+	waitForContinue, ok := expectation(req)
+	if !ok {
+		watcher.stop()
 		hErr := &HandlerError{
-			StatusCode: response.BadRequest,
-			Message:    err.Error(),
+			StatusCode:  response.ExpectationFailed,
+			Message:     "unsupported expectation: " + req.Headers.Get("Expect"),
+			HTTPVersion: req.RequestLine.HttpVersion,
+			Method:      req.RequestLine.Method,
 		}
 		hErr.Write(conn)
+		return false
+	}
+	body := &bodyErrRecorder{ReadCloser: req.Body}
+	req.Body = body
+	// With an empty body the client has nothing to hold back, so there is
+	// no continue to send and no reason to close if the handler never asks.
+	if waitForContinue && req.HasBody() {
+		writer.ExpectContinue()
+		req.Body = &continueBody{ReadCloser: req.Body, w: writer}
+	}
+	if s.runHandler(writer, req, conn) {
+		watcher.stop()
+		// The response is only salvageable if nothing of it reached the
+		// client yet; the 500 then replaces whatever was buffered.
+		if writer.Discard() {
+			hErr := &HandlerError{
+				StatusCode:  response.InternalServerError,
+				Message:     "Internal Server Error",
+				HTTPVersion: req.RequestLine.HttpVersion,
+				Method:      req.RequestLine.Method,
+			}
+			hErr.Write(writer.Writer)
+		}
+		return false
+	}
+
+	// Whatever the handler left unread has to be drained before the next
+	// request can be parsed; if that fails the connection is done. While
+	// the response is still uncommitted the body goes first, so a body
+	// that was too large, too slow or malformed is answered as such
+	// rather than with whatever the handler made of it.
+	var bodyErr error
+	bodyClosed := false
+	if !writer.HeadersWritten() {
+		bodyErr = req.Body.Close()
+		bodyClosed = true
+		if code, ok := statusForBodyError(cmp.Or(body.err, bodyErr)); ok && writer.Discard() {
+			watcher.stop()
+			hErr := &HandlerError{
+				StatusCode:  code,
+				Message:     cmp.Or(body.err, bodyErr).Error(),
+				HTTPVersion: req.RequestLine.HttpVersion,
+				Method:      req.RequestLine.Method,
+			}
+			hErr.Write(writer.Writer)
+			return false
+		}
+		if bodyErr != nil {
+			writer.CloseAfterResponse()
+		}
+	}
+	if err := writer.Finish(); err != nil {
+		watcher.stop()
+		return false
+	}
+	if err := writer.Release(); err != nil {
+		watcher.stop()
+		return false
+	}
+	if !bodyClosed {
+		bodyErr = req.Body.Close()
+	}
+	if watcher.stop() {
+		return false
+	}
+	if bodyErr != nil || body.err != nil {
+		return false
+	}
+	setWriteDeadline(conn, 0)
+	return !writer.ShouldClose()
+}
+
+// runHandler calls the handler and reports whether it panicked. The panic
+// only ends this connection, not the server.
+func (s *Server) runHandler(w response.Writer, req *request.Request, conn net.Conn) (panicked bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			s.logf("server: panic serving %v %s: %v\n%s", conn.RemoteAddr(), req.RequestLine.RequestTarget, v, debug.Stack())
+			panicked = true
+		}
+	}()
+	s.handler(w, req)
+	return false
+}
+
+func (s *Server) baseContext() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+// statusForError picks the response for a request that failed to parse.
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return response.URITooLong
+	case errors.Is(err, request.ErrHeadersTooLarge), errors.Is(err, request.ErrTooManyHeaders):
+		return response.RequestHeaderFieldsTooLarge
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.ContentTooLarge
+	default:
+		return response.BadRequest
+	}
+}
+
+// statusForBodyError picks the response for a request body that could not
+// be read. It reports false when nobody is left to answer, or when the
+// body was merely left unread.
+func statusForBodyError(err error) (response.StatusCode, bool) {
+	switch {
+	case err == nil,
+		errors.Is(err, errContinueNotSent),
+		errors.Is(err, request.ErrBodyNotDrained),
+		errors.Is(err, request.ErrBodyReadAfterClose),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, net.ErrClosed):
+		return 0, false
+	case isTimeout(err):
+		return response.RequestTimeout, true
+	default:
+		return statusForError(err), true
+	}
+}
+
+// bodyErrRecorder keeps the first error the handler got reading the body,
+// which it may well have swallowed.
+type bodyErrRecorder struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *bodyErrRecorder) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && !errors.Is(err, request.ErrBodyReadAfterClose) && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// setReadDeadline arms a read deadline d from now, or clears it when d is
+// zero.
+func setReadDeadline(conn net.Conn, d time.Duration) {
+	if d > 0 {
+		conn.SetReadDeadline(time.Now().Add(d))
 		return
 	}
+	conn.SetReadDeadline(time.Time{})
+}
 
-	writer := response.NewResponse(conn)
-	s.handler(writer, req)
+func setWriteDeadline(conn net.Conn, d time.Duration) {
+	if d > 0 {
+		conn.SetWriteDeadline(time.Now().Add(d))
+		return
+	}
+	conn.SetWriteDeadline(time.Time{})
+}
+
+// isTemporary reports whether an accept error is worth retrying.
+func isTemporary(err error) bool {
+	return isTimeout(err) ||
+		errors.Is(err, syscall.EMFILE) ||
+		errors.Is(err, syscall.ENFILE) ||
+		errors.Is(err, syscall.ENOBUFS) ||
+		errors.Is(err, syscall.ENOMEM) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
 
-	return
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
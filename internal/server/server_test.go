@@ -0,0 +1,926 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/GhostVox/httptcp/internal/headers"
+	"github.com/GhostVox/httptcp/internal/request"
+	"github.com/GhostVox/httptcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoTarget(w response.Writer, req *request.Request) {
+	body := req.RequestLine.RequestTarget
+	w.WriteStatusLine(response.Success)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.Writer.Write([]byte(body))
+}
+
+// readResponse reads one Content-Length framed response and returns the
+// Connection header and body.
+func readResponse(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	statusLine, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(statusLine, "HTTP/1.1 200"))
+	length, connection := 0, ""
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		key, value, _ := strings.Cut(line, ": ")
+		switch strings.ToLower(key) {
+		case "content-length":
+			length, err = strconv.Atoi(value)
+			require.NoError(t, err)
+		case "connection":
+			connection = value
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	require.NoError(t, err)
+	return connection, string(body)
+}
+
+func TestHandle_KeepAlive(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: echoTarget}
+	done := make(chan struct{})
+	go func() {
+		s.Handle(conn)
+		close(done)
+	}()
+
+	r := bufio.NewReader(client)
+	client.Write([]byte("GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	connection, body := readResponse(t, r)
+	assert.Equal(t, "", connection)
+	assert.Equal(t, "/one", body)
+
+	client.Write([]byte("GET /two HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	connection, body = readResponse(t, r)
+	assert.Equal(t, "close", connection)
+	assert.Equal(t, "/two", body)
+	<-done
+}
+
+func TestHandle_MaxRequestsPerConn(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: echoTarget}
+	WithMaxRequestsPerConn(2)(s)
+	done := make(chan struct{})
+	go func() {
+		s.Handle(conn)
+		close(done)
+	}()
+
+	r := bufio.NewReader(client)
+	client.Write([]byte("GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	connection, _ := readResponse(t, r)
+	assert.Equal(t, "", connection)
+	client.Write([]byte("GET /two HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	connection, _ = readResponse(t, r)
+	assert.Equal(t, "close", connection)
+	<-done
+}
+
+func TestHandle_Pipelining(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: echoTarget}
+	WithMaxPipelineDepth(3)(s)
+	done := make(chan struct{})
+	go func() {
+		s.Handle(conn)
+		close(done)
+	}()
+
+	// net.Pipe writes block until read, so send from a separate goroutine
+	// while responses are being consumed.
+	go client.Write([]byte(
+		"GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+			"POST /two HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc" +
+			"GET /three HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+			"GET /four HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+
+	r := bufio.NewReader(client)
+	for _, want := range []string{"/one", "/two"} {
+		connection, body := readResponse(t, r)
+		assert.Equal(t, "", connection)
+		assert.Equal(t, want, body)
+	}
+	connection, body := readResponse(t, r)
+	assert.Equal(t, "close", connection)
+	assert.Equal(t, "/three", body)
+	<-done
+}
+
+func TestHandle_ParserLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		status string
+	}{
+		{
+			name:   "Long request line",
+			input:  "GET /" + strings.Repeat("a", 100) + " HTTP/1.1\r\n\r\n",
+			status: "HTTP/1.1 414 URI Too Long\r\n",
+		},
+		{
+			name:   "Too many headers",
+			input:  "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n",
+			status: "HTTP/1.1 431 Request Header Fields Too Large\r\n",
+		},
+		{
+			name:   "Large body",
+			input:  "POST / HTTP/1.1\r\nContent-Length: 100\r\n\r\n",
+			status: "HTTP/1.1 413 Content Too Large\r\n",
+		},
+		{
+			name:   "Malformed request",
+			input:  "GET /\r\n\r\n",
+			status: "HTTP/1.1 400 Bad Request\r\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, conn := net.Pipe()
+			defer client.Close()
+			s := &Server{handler: echoTarget}
+			WithParserConfig(request.ParserConfig{
+				MaxRequestLineBytes: 64,
+				MaxHeaderCount:      2,
+				MaxBodyBytes:        10,
+			})(s)
+			go s.Handle(conn)
+			go client.Write([]byte(tc.input))
+
+			statusLine, err := bufio.NewReader(client).ReadString('\n')
+			require.NoError(t, err)
+			assert.Equal(t, tc.status, statusLine)
+		})
+	}
+}
+
+func TestHandle_ContextCancelledOnDisconnect(t *testing.T) {
+	client, conn := net.Pipe()
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		close(started)
+		<-req.Context().Done()
+		close(cancelled)
+	}}
+	go s.Handle(conn)
+
+	client.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	<-started
+	client.Close()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("request context was not cancelled after the client hung up")
+	}
+}
+
+func TestHandle_ReadHeaderTimeout(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: echoTarget}
+	WithReadHeaderTimeout(50 * time.Millisecond)(s)
+	done := make(chan struct{})
+	go func() {
+		s.Handle(conn)
+		close(done)
+	}()
+
+	// A slowloris client that never finishes its headers.
+	client.Write([]byte("GET / HTTP/1.1\r\nHost: local"))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("connection was not closed after the header timeout")
+	}
+}
+
+func TestHandle_IdleTimeout(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: echoTarget}
+	WithIdleTimeout(50 * time.Millisecond)(s)
+	done := make(chan struct{})
+	go func() {
+		s.Handle(conn)
+		close(done)
+	}()
+
+	go client.Write([]byte("GET /first HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	r := bufio.NewReader(client)
+	_, body := readResponse(t, r)
+	assert.Equal(t, "/first", body)
+
+	// No second request follows, so the connection is closed.
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection was not closed after the idle timeout")
+	}
+	_, err := r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHandle_WriteTimeout(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	writeErr := make(chan error, 1)
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Success)
+		w.WriteHeaders(response.GetDefaultHeaders(1 << 20))
+		_, err := w.Writer.Write(make([]byte, 1<<20))
+		writeErr <- err
+	}}
+	WithWriteTimeout(50 * time.Millisecond)(s)
+	done := make(chan struct{})
+	go func() {
+		s.Handle(conn)
+		close(done)
+	}()
+
+	// The client sends its request and never reads the response.
+	client.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	select {
+	case err := <-writeErr:
+		assert.True(t, isTimeout(err), "%v", err)
+	case <-time.After(time.Second):
+		t.Fatal("write to a stalled client did not time out")
+	}
+	<-done
+}
+
+func TestShutdown_DrainsActiveRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	s, err := Serve(0, func(w response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			close(started)
+			<-release
+		}
+		echoTarget(w, req)
+	})
+	require.NoError(t, err)
+	hookCalled := make(chan struct{})
+	s.RegisterOnShutdown(func() { close(hookCalled) })
+
+	active, err := net.Dial("tcp", s.server.Addr().String())
+	require.NoError(t, err)
+	defer active.Close()
+	idle, err := net.Dial("tcp", s.server.Addr().String())
+	require.NoError(t, err)
+	defer idle.Close()
+	// A keep-alive connection that has finished its request is idle.
+	idle.Write([]byte("GET /fast HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	idleReader := bufio.NewReader(idle)
+	_, body := readResponse(t, idleReader)
+	require.Equal(t, "/fast", body)
+
+	active.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	<-started
+
+	shutdownErr := make(chan error)
+	go func() {
+		shutdownErr <- s.Shutdown(context.Background())
+	}()
+	<-hookCalled
+
+	// The idle connection is closed without a response.
+	_, err = idleReader.ReadByte()
+	assert.Error(t, err)
+
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown returned while a request was in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	_, body = readResponse(t, bufio.NewReader(active))
+	assert.Equal(t, "/slow", body)
+	require.NoError(t, <-shutdownErr)
+}
+
+func TestShutdown_NewConnGracePeriod(t *testing.T) {
+	s := &Server{}
+	fresh, freshPeer := net.Pipe()
+	defer freshPeer.Close()
+	stale, stalePeer := net.Pipe()
+	defer stalePeer.Close()
+	s.trackConn(fresh, stateNew)
+	s.trackConn(stale, stateNew)
+	s.conns[stale] = trackedConn{state: stateNew, since: time.Now().Add(-newConnGracePeriod)}
+
+	// A new connection may have an unread request waiting, so only the one
+	// past the grace period is closed.
+	assert.False(t, s.closeIdleConns())
+	assert.Contains(t, s.conns, fresh)
+	assert.NotContains(t, s.conns, stale)
+
+	// Tracking a connection again in the same state keeps its age.
+	s.conns[fresh] = trackedConn{state: stateNew, since: time.Now().Add(-newConnGracePeriod)}
+	s.trackConn(fresh, stateNew)
+	assert.True(t, s.closeIdleConns())
+}
+
+func TestShutdown_ForceClosesOnDeadline(t *testing.T) {
+	cancelled := make(chan struct{})
+	started := make(chan struct{})
+	s, err := Serve(0, func(w response.Writer, req *request.Request) {
+		close(started)
+		<-req.Context().Done()
+		close(cancelled)
+	})
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", s.server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	<-cancelled
+}
+
+func TestHandle_RecoversPanic(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	var logs strings.Builder
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		panic("boom")
+	}}
+	WithErrorLog(log.New(&logs, "", 0))(s)
+	done := make(chan struct{})
+	go func() {
+		s.Handle(conn)
+		close(done)
+	}()
+
+	client.Write([]byte("GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	statusLine, err := bufio.NewReader(client).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error\r\n", statusLine)
+	client.Close()
+	<-done
+	assert.Contains(t, logs.String(), "panic serving")
+	assert.Contains(t, logs.String(), "boom")
+}
+
+func TestHandle_PanicAfterStatusLine(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		flush bool
+		want  string
+	}{
+		{"nothing sent", false, "HTTP/1.1 500 Internal Server Error\r\n"},
+		{"headers flushed", true, "HTTP/1.1 200 OK\r\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, conn := net.Pipe()
+			defer client.Close()
+			s := &Server{handler: func(w response.Writer, req *request.Request) {
+				w.WriteStatusLine(response.Success)
+				if tc.flush {
+					w.Flush()
+				}
+				panic("boom")
+			}}
+			WithErrorLog(log.New(io.Discard, "", 0))(s)
+			go s.Handle(conn)
+
+			go client.Write([]byte("GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			out, err := io.ReadAll(client)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(out), tc.want), "%q", out)
+			if !tc.flush {
+				assert.Contains(t, string(out), "Connection: close\r\n")
+				assert.True(t, strings.HasSuffix(string(out), "\r\n\r\nInternal Server Error"), "%q", out)
+			}
+		})
+	}
+}
+
+func TestHandle_PanicAfterContinue(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		req.ReadBody()
+		w.WriteStatusLine(response.Success)
+		panic("boom")
+	}}
+	WithErrorLog(log.New(io.Discard, "", 0))(s)
+	go s.Handle(conn)
+
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\nhello"))
+	out, err := io.ReadAll(client)
+	require.NoError(t, err)
+	interim, final, ok := strings.Cut(string(out), "\r\n\r\n")
+	require.True(t, ok, "%q", out)
+	assert.Equal(t, "HTTP/1.1 100 Continue", interim)
+	assert.True(t, strings.HasPrefix(final, "HTTP/1.1 500 Internal Server Error\r\n"), "%q", final)
+}
+
+func TestHandle_ErrorsForHTTP10(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler Handler
+		input   string
+		status  string
+	}{
+		{
+			name:    "Panic",
+			handler: func(w response.Writer, req *request.Request) { panic("boom") },
+			input:   "GET / HTTP/1.0\r\n\r\n",
+			status:  "HTTP/1.0 500 Internal Server Error\r\n",
+		},
+		{
+			name:    "Too many headers",
+			handler: echoTarget,
+			input:   "GET / HTTP/1.0\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n",
+			status:  "HTTP/1.0 431 Request Header Fields Too Large\r\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, conn := net.Pipe()
+			defer client.Close()
+			s := &Server{handler: tc.handler}
+			WithErrorLog(log.New(io.Discard, "", 0))(s)
+			WithParserConfig(request.ParserConfig{MaxHeaderCount: 2})(s)
+			go s.Handle(conn)
+
+			go client.Write([]byte(tc.input))
+			out, err := io.ReadAll(client)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(out), tc.status), "%q", out)
+			assert.Contains(t, string(out), "Connection: close\r\n")
+		})
+	}
+}
+
+// flakyListener fails with EMFILE a few times before handing out conns.
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+	return l.Listener.Accept()
+}
+
+func TestListen_RetriesTemporaryAcceptErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	var logs strings.Builder
+	s := &Server{
+		server:  &flakyListener{Listener: ln, failures: 3},
+		handler: echoTarget,
+	}
+	WithErrorLog(log.New(&logs, "", 0))(s)
+	go s.listen()
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.Write([]byte("GET /after HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	_, body := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "/after", body)
+	assert.Equal(t, 3, strings.Count(logs.String(), "accept error"))
+}
+
+func TestHandle_HTTP10(t *testing.T) {
+	chunked := func(w response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Success)
+		h := response.GetDefaultHeaders(0)
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Sum")
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte("hello "))
+		w.WriteChunkedBody([]byte("world"))
+		w.WriteChunkedBodyEnd()
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Sum", "abc")
+		w.WriteTrailers(trailers)
+	}
+
+	// Test: Chunked responses become close-delimited
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: chunked}
+	go s.Handle(conn)
+	go client.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	out, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.0 200 OK\r\n"), string(out))
+	assert.Contains(t, string(out), "Connection: close\r\n")
+	assert.NotContains(t, string(out), "Transfer-Encoding")
+	assert.NotContains(t, string(out), "Trailer")
+	assert.True(t, strings.HasSuffix(string(out), "\r\n\r\nhello world"), string(out))
+
+	// Test: Keep-alive is honored for framed responses
+	client, conn = net.Pipe()
+	defer client.Close()
+	s = &Server{handler: echoTarget}
+	go s.Handle(conn)
+	r := bufio.NewReader(client)
+	go client.Write([]byte("GET /one HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+	statusLine, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n", statusLine)
+	var connection string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		if strings.HasPrefix(line, "Connection: ") {
+			connection = strings.TrimSpace(strings.TrimPrefix(line, "Connection: "))
+		}
+	}
+	assert.Equal(t, "keep-alive", connection)
+}
+
+func echoBody(w response.Writer, req *request.Request) {
+	body, err := req.ReadBody()
+	if err != nil {
+		return
+	}
+	w.WriteStatusLine(response.Success)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.Writer.Write(body)
+}
+
+func TestHandle_BodyErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		status string
+	}{
+		{
+			name:   "Chunked body over the limit",
+			input:  "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n10\r\n0123456789abcdef\r\n0\r\n\r\n",
+			status: "HTTP/1.1 413 Content Too Large\r\n",
+		},
+		{
+			name:   "Malformed chunk size",
+			input:  "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n",
+			status: "HTTP/1.1 400 Bad Request\r\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, conn := net.Pipe()
+			defer client.Close()
+			s := &Server{handler: echoBody}
+			WithParserConfig(request.ParserConfig{MaxBodyBytes: 4})(s)
+			go s.Handle(conn)
+
+			go client.Write([]byte(tc.input))
+			out, err := io.ReadAll(client)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(out), tc.status), "%q", out)
+			assert.Contains(t, string(out), "Connection: close\r\n")
+		})
+	}
+}
+
+func TestHandle_ReadBodyTimeout(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: echoBody}
+	WithReadBodyTimeout(50 * time.Millisecond)(s)
+	go s.Handle(conn)
+
+	// The body stalls after two of its ten bytes.
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nab"))
+	out, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 408 Request Timeout\r\n"), "%q", out)
+	assert.Contains(t, string(out), "Connection: close\r\n")
+}
+
+func TestHandle_ExpectContinue(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: echoBody}
+	go s.Handle(conn)
+
+	r := bufio.NewReader(client)
+	client.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+	interim, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", interim)
+	blank, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", blank)
+
+	client.Write([]byte("hello"))
+	connection, body := readResponse(t, r)
+	assert.Equal(t, "", connection)
+	assert.Equal(t, "hello", body)
+}
+
+func TestHandle_EmptyResponse(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget != "/silent" {
+			echoTarget(w, req)
+		}
+	}}
+	go s.Handle(conn)
+
+	// A handler that writes nothing sends an empty 200 and the connection
+	// carries on.
+	go client.Write([]byte("GET /silent HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /next HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	r := bufio.NewReader(client)
+	connection, body := readResponse(t, r)
+	assert.Equal(t, "", connection)
+	assert.Equal(t, "", body)
+	_, body = readResponse(t, r)
+	assert.Equal(t, "/next", body)
+}
+
+func TestHandle_HEAD(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		io.WriteString(w, req.RequestLine.RequestTarget)
+	}}
+	go s.Handle(conn)
+
+	// The HEAD response has the length of the body it leaves out; the
+	// next response follows straight after its headers.
+	go client.Write([]byte("HEAD /page HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /next HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	r := bufio.NewReader(client)
+	var head []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		head = append(head, strings.TrimRight(line, "\r\n"))
+	}
+	assert.Equal(t, "HTTP/1.1 200 OK", head[0])
+	assert.Contains(t, head, "Content-Length: 5")
+	_, body := readResponse(t, r)
+	assert.Equal(t, "/next", body)
+}
+
+func TestHandle_ExpectContinueEmptyBody(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: echoTarget}
+	go s.Handle(conn)
+
+	// Nothing is held back, so the connection stays usable for the
+	// pipelined request even though the handler never reads the body.
+	go client.Write([]byte("POST /empty HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\nExpect: 100-continue\r\n\r\n" +
+		"GET /next HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	r := bufio.NewReader(client)
+	connection, body := readResponse(t, r)
+	assert.Equal(t, "", connection)
+	assert.Equal(t, "/empty", body)
+	_, body = readResponse(t, r)
+	assert.Equal(t, "/next", body)
+}
+
+func TestHandle_ExpectContinueRejected(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		message := "too big"
+		w.WriteStatusLine(response.ContentTooLarge)
+		w.WriteHeaders(response.GetDefaultHeaders(len(message)))
+		w.Writer.Write([]byte(message))
+	}}
+	done := make(chan struct{})
+	go func() {
+		s.Handle(conn)
+		close(done)
+	}()
+
+	go client.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5000000\r\nExpect: 100-continue\r\n\r\n"))
+	out, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 413 Content Too Large\r\n"), string(out))
+	assert.Contains(t, string(out), "Connection: close\r\n")
+	<-done
+}
+
+func TestHandle_UnsupportedExpectation(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: echoBody}
+	go s.Handle(conn)
+
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1\r\nExpect: teapot\r\n\r\n"))
+	statusLine, err := bufio.NewReader(client).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 417 Expectation Failed\r\n", statusLine)
+}
+
+func TestWriter_EarlyHints(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		hints := headers.NewHeaders()
+		hints.Set("Link", "</style.css>; rel=preload")
+		w.WriteInformational(response.EarlyHints, hints)
+		echoTarget(w, req)
+	}}
+	go s.Handle(conn)
+
+	r := bufio.NewReader(client)
+	go client.Write([]byte("GET /page HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	interim, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\n", interim)
+	link, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "Link: </style.css>; rel=preload\r\n", link)
+	blank, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", blank)
+	_, body := readResponse(t, r)
+	assert.Equal(t, "/page", body)
+}
+
+// testDate stands in for the Date header in tests that compare responses
+// byte for byte.
+const testDate = "Sun, 06 Nov 1994 08:49:37 GMT"
+
+func TestWriter_RepeatedHeaders(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Success)
+		h := response.GetDefaultHeaders(0)
+		h.Add("Set-Cookie", "a=1")
+		h.Add("Set-Cookie", "b=2")
+		h.Set("Date", testDate)
+		w.WriteHeaders(h)
+	}}
+	go s.Handle(conn)
+
+	r := bufio.NewReader(client)
+	go client.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	assert.Equal(t, []string{
+		"HTTP/1.1 200 OK\r\n",
+		"Content-Type: text/plain\r\n",
+		"Content-Length: 0\r\n",
+		"Set-Cookie: a=1\r\n",
+		"Set-Cookie: b=2\r\n",
+		"Date: " + testDate + "\r\n",
+		"Connection: close\r\n",
+	}, lines)
+}
+
+func TestWriter_SortedHeaderOrder(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{headerOrder: response.SortedOrder, handler: func(w response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Success)
+		h := headers.NewHeaders()
+		h.Set("X-Zeta", "1")
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("trailer", "X-B, X-A")
+		h.Add("x-alpha", "2")
+		h.Add("X-Alpha", "3")
+		h.Set("Date", testDate)
+		w.WriteHeaders(h)
+		w.WriteChunkedBodyEnd()
+		trailers := headers.NewHeaders()
+		trailers.Set("X-B", "b")
+		trailers.Set("X-A", "a")
+		w.WriteTrailers(trailers)
+	}}
+	go s.Handle(conn)
+
+	go client.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	raw, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Connection: close\r\n"+
+		"Date: "+testDate+"\r\n"+
+		"trailer: X-B, X-A\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"x-alpha: 2\r\n"+
+		"x-alpha: 3\r\n"+
+		"X-Zeta: 1\r\n"+
+		"\r\n"+
+		"0\r\n"+
+		"X-A: a\r\n"+
+		"X-B: b\r\n"+
+		"\r\n", string(raw))
+}
+
+func TestWriter_RejectsHeaderInjection(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	writeErr := make(chan error, 1)
+	s := &Server{handler: func(w response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Success)
+		h := response.GetDefaultHeaders(0)
+		h.Set("X-Echo", req.URL.Query().Get("v"))
+		writeErr <- w.WriteHeaders(h)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	}}
+	go s.Handle(conn)
+
+	go client.Write([]byte("GET /?v=a%0d%0aSet-Cookie:%20x=1 HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	raw, err := io.ReadAll(client)
+	require.NoError(t, err)
+	var fieldErr *headers.FieldError
+	require.ErrorAs(t, <-writeErr, &fieldErr)
+	assert.Equal(t, "X-Echo", fieldErr.Name)
+	assert.NotContains(t, string(raw), "Set-Cookie")
+	assert.NotContains(t, string(raw), "X-Echo")
+}
+
+func TestHandle_AutoFraming(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	s := &Server{responseBufferSize: 8, handler: func(w response.Writer, req *request.Request) {
+		io.WriteString(w, strings.TrimPrefix(req.RequestLine.RequestTarget, "/"))
+	}}
+	go s.Handle(conn)
+
+	r := bufio.NewReader(client)
+	go client.Write([]byte("GET /short HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	connection, body := readResponse(t, r)
+	assert.Equal(t, "", connection)
+	assert.Equal(t, "short", body)
+
+	// The body outgrows the buffer, so it is chunked and the connection
+	// stays usable.
+	go client.Write([]byte("GET /longer-than-eight HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	statusLine, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", statusLine)
+	chunked := false
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		chunked = chunked || line == "Transfer-Encoding: chunked\r\n"
+	}
+	assert.True(t, chunked)
+	req, err := request.RequestFromReader(io.MultiReader(
+		strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"), r))
+	require.NoError(t, err)
+	body2, err := req.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "longer-than-eight", string(body2))
+
+	go client.Write([]byte("GET /again HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	_, body = readResponse(t, r)
+	assert.Equal(t, "again", body)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+type connState int
+
+const (
+	// stateNew is a connection that has not sent a request yet.
+	stateNew connState = iota
+	// stateActive is a connection with a request in flight.
+	stateActive
+	// stateIdle is a keep-alive connection waiting for its next request.
+	stateIdle
+)
+
+// trackedConn is what Shutdown knows about a connection: its state and
+// when it entered it.
+type trackedConn struct {
+	state connState
+	since time.Time
+}
+
+const shutdownPollInterval = 50 * time.Millisecond
+
+// newConnGracePeriod is how long Shutdown treats a connection that has not
+// sent a request as active. Its first request may already be in the socket
+// buffer, unread; after this long it is taken to be idle.
+const newConnGracePeriod = 5 * time.Second
+
+// RegisterOnShutdown registers a function to call when Shutdown starts. It
+// runs in its own goroutine and is meant for long-running handlers, such as
+// streams, that should wind down instead of holding the shutdown up.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	s.onShutdown = append(s.onShutdown, f)
+	s.mu.Unlock()
+}
+
+// Shutdown stops accepting connections, closes idle ones and waits for
+// in-flight requests to finish; their responses carry "Connection: close".
+// If ctx expires first, request contexts are cancelled and the remaining
+// connections are closed, and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closed.Store(true)
+	err := s.server.Close()
+
+	s.mu.Lock()
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.closeAllConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns closes connections without a request in flight and reports
+// whether none are left. New connections count as idle only once they are
+// older than newConnGracePeriod.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for conn, tc := range s.conns {
+		if tc.state == stateActive {
+			continue
+		}
+		if tc.state == stateNew && now.Sub(tc.since) < newConnGracePeriod {
+			continue
+		}
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return len(s.conns) == 0
+}
+
+func (s *Server) closeAllConns() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+func (s *Server) trackConn(conn net.Conn, state connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]trackedConn)
+	}
+	if tc, ok := s.conns[conn]; ok && tc.state == state {
+		return
+	}
+	s.conns[conn] = trackedConn{state: state, since: time.Now()}
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}